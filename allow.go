@@ -0,0 +1,28 @@
+package quest
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// ErrHostNotAllowed is returned for requests to a host outside the client's AllowHosts
+var ErrHostNotAllowed = errors.New("host is not allowed")
+
+// AllowHosts restricts the client to sending requests to hosts matching one of the
+// patterns. A pattern may start with "*." to match any subdomain. Requests to other
+// hosts fail as soon as they are created, before any network i/o, and redirects to
+// them are not followed. This guards services that build urls from user input
+// against server-side request forgery.
+func (c *Client) AllowHosts(patterns ...string) *Client {
+	c.allowedHosts = append(c.allowedHosts, patterns...)
+	return c
+}
+
+// checkHost fails if u's host is not allowed by the client
+func (c *Client) checkHost(u *url.URL) error {
+	if len(c.allowedHosts) == 0 || matchAnyHost(c.allowedHosts, u.Hostname()) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrHostNotAllowed, u.Hostname())
+}
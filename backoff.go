@@ -0,0 +1,73 @@
+package quest
+
+import (
+	"math"
+	"time"
+)
+
+// Backoff decides how long to wait before a request is retried
+type Backoff interface {
+	// Delay returns the wait before retry number attempt, starting at 1. random is
+	// a pseudo-random number in [0.0,1.0) that can be used for jitter.
+	Delay(attempt int, random float64) time.Duration
+}
+
+// ExponentialBackoff waits Initial before the first retry and Multiplier times
+// longer before each following one, up to Max
+type ExponentialBackoff struct {
+	// Initial defaults to 100ms
+	Initial time.Duration
+	// Max is the longest wait; zero means no limit
+	Max time.Duration
+	// Multiplier defaults to 2
+	Multiplier float64
+	// Jitter is the fraction of each wait that is randomized, from 0 (none) to 1
+	// (the wait is anywhere between zero and the full delay)
+	Jitter float64
+}
+
+// Delay implements Backoff
+func (b ExponentialBackoff) Delay(attempt int, random float64) time.Duration {
+	initial := b.Initial
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if jitter := math.Min(math.Max(b.Jitter, 0), 1); jitter > 0 {
+		delay -= delay * jitter * random
+	}
+	return time.Duration(delay)
+}
+
+// ConstantBackoff waits the same time before every retry
+type ConstantBackoff time.Duration
+
+// Delay implements Backoff
+func (b ConstantBackoff) Delay(attempt int, random float64) time.Duration {
+	return time.Duration(b)
+}
+
+// Retry makes Send retry the request up to n times when it fails with a network
+// error or a 502, 503 or 504 status code, or a 429 with a Retry-After header. A host
+// that was not found is not retried (see Client.RetryDNS). It waits as long as the
+// Retry-After header asks, or otherwise according to Backoff (an
+// ExponentialBackoff by default). The body is replayed for every attempt. Any
+// method is retried, so only use it with requests that are safe to send more than
+// once.
+func (r *Request) Retry(n int) *Request {
+	r.retries = n
+	return r
+}
+
+// Backoff sets how long to wait between the attempts made by Retry
+func (r *Request) Backoff(b Backoff) *Request {
+	r.backoff = b
+	return r
+}
@@ -0,0 +1,118 @@
+package quest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// Batch creates a new http "POST" request for path (uri) whose body is a
+// multipart/mixed batch of the given requests, as used by Google and OData style
+// batch endpoints. Use GetBatch to split the batched response.
+func Batch(path string, requests ...*Request) *Request {
+	batch := Post(path)
+	if batch.err != nil {
+		return batch
+	}
+	batch.batch = requests
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for i, req := range requests {
+		if req.err != nil {
+			batch.err = req.err
+			return batch
+		}
+		httpReq, err := req.newHTTPRequest()
+		if err != nil {
+			batch.err = handleRequestError(err, batch)
+			return batch
+		}
+		for key, value := range req.headers {
+			httpReq.Header.Set(key, value)
+		}
+
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/http"},
+			"Content-Transfer-Encoding": {"binary"},
+			"Content-Id":                {fmt.Sprintf("<item%d>", i+1)},
+		})
+		if err == nil {
+			err = httpReq.Write(part)
+		}
+		if err != nil {
+			batch.err = handleRequestError(err, batch)
+			return batch
+		}
+	}
+	if err := writer.Close(); err != nil {
+		batch.err = handleRequestError(err, batch)
+		return batch
+	}
+
+	batch.Header("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	return batch.Body(&buf)
+}
+
+// GetBatch splits a multipart/mixed batch response into a response for each of the
+// batched requests and stores them, in order, into into parameter
+func (r *Response) GetBatch(into *[]*Response) *Response {
+	if r.req.err != nil {
+		return r
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Response.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		err := fmt.Errorf("Invalid Header. Expected a multipart batch response, got %q", r.Response.Header.Get("Content-Type"))
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+
+	body, err := r.readBody()
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+
+	var responses []*Response
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for i := 0; ; i++ {
+		part, err := reader.NextPart()
+		if err != nil {
+			if err != io.EOF {
+				r.req.err = handleResponseError(err, r.req, r)
+				return r
+			}
+			break
+		}
+
+		req := r.req
+		if i < len(r.req.batch) {
+			req = r.req.batch[i]
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			err = fmt.Errorf("Invalid Batch. Part %d: %v", i+1, err)
+			r.req.err = handleResponseError(err, r.req, r)
+			return r
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			r.req.err = handleResponseError(err, r.req, r)
+			return r
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+		responses = append(responses, &Response{Response: resp, req: req})
+	}
+
+	*into = responses
+	return r
+}
@@ -0,0 +1,150 @@
+package quest
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BreakerSettings configures a circuit breaker added with Client.WithBreaker
+type BreakerSettings struct {
+	// Failures is how many consecutive failures trip the breaker. Defaults to 5.
+	Failures int
+	// Cooldown is how long the breaker stays open before a single trial request is
+	// let through. Defaults to 30 seconds.
+	Cooldown time.Duration
+}
+
+// BreakerOpenError is returned by Send, without sending the request, while the
+// circuit breaker for the request's host is open
+type BreakerOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *BreakerOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s is open until %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// WithBreaker adds a circuit breaker for requests to hosts matching host ("*" and
+// "*.example.com" patterns are allowed). Each host gets its own breaker, which
+// opens after consecutive network errors or 5xx responses and makes Send fail fast
+// with a *BreakerOpenError until its cooldown has passed.
+func (c *Client) WithBreaker(host string, settings BreakerSettings) *Client {
+	if settings.Failures <= 0 {
+		settings.Failures = 5
+	}
+	if settings.Cooldown <= 0 {
+		settings.Cooldown = 30 * time.Second
+	}
+	if c.breakers == nil {
+		c.breakers = &breakers{hosts: map[string]*breaker{}}
+	}
+	c.breakers.mu.Lock()
+	c.breakers.patterns = append(c.breakers.patterns, breakerPattern{host, settings})
+	c.breakers.mu.Unlock()
+	return c
+}
+
+type breakerPattern struct {
+	pattern  string
+	settings BreakerSettings
+}
+
+// breakers holds the state of a client's circuit breakers
+type breakers struct {
+	mu       sync.Mutex
+	patterns []breakerPattern
+	hosts    map[string]*breaker
+}
+
+type breaker struct {
+	settings  BreakerSettings
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// get returns the breaker for host, or nil if no pattern matches it
+func (b *breakers) get(host, hostname string) *breaker {
+	if br, ok := b.hosts[host]; ok {
+		return br
+	}
+	for _, p := range b.patterns {
+		if matchHost(p.pattern, hostname) {
+			br := &breaker{settings: p.settings}
+			b.hosts[host] = br
+			return br
+		}
+	}
+	return nil
+}
+
+// allow returns an error if a request to the url's host must fail fast
+func (b *breakers) allow(req *http.Request, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.get(req.URL.Host, req.URL.Hostname())
+	if br == nil || br.failures < br.settings.Failures {
+		return nil
+	}
+	if now.Before(br.openUntil) || br.probing {
+		return &BreakerOpenError{Host: req.URL.Host, Until: br.openUntil}
+	}
+	// half open: let a single trial request through
+	br.probing = true
+	return nil
+}
+
+// observe records the outcome of a request to host and reports whether the
+// breaker changed state
+func (b *breakers) observe(host string, failed bool, now time.Time) (changed, open bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.hosts[host]
+	if !ok {
+		return false, false
+	}
+	wasOpen := br.failures >= br.settings.Failures
+	br.probing = false
+	if !failed {
+		br.failures = 0
+		return wasOpen, false
+	}
+	br.failures++
+	if br.failures >= br.settings.Failures {
+		br.openUntil = now.Add(br.settings.Cooldown)
+		return !wasOpen, true
+	}
+	return false, false
+}
+
+// abort lets another trial request through after one was cancelled by its caller
+func (b *breakers) abort(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if br, ok := b.hosts[host]; ok {
+		br.probing = false
+	}
+}
+
+// observeBreaker records the outcome of a request for the host's circuit breaker.
+// Requests cancelled by their caller are not counted.
+func (c *Client) observeBreaker(r *Request, host string, resp *http.Response, err error) {
+	if c.breakers == nil {
+		return
+	}
+	if err != nil && r.Context().Err() != nil {
+		c.breakers.abort(host)
+		return
+	}
+	failed := err != nil || resp.StatusCode >= 500
+	if changed, open := c.breakers.observe(host, failed, r.clock().Now()); changed {
+		value := 0.0
+		if open {
+			value = 1
+		}
+		c.emit(Metric{Name: MetricBreakerOpen, Value: value, Labels: map[string]string{"host": host}})
+	}
+}
@@ -0,0 +1,31 @@
+package quest
+
+import (
+	"bytes"
+	"io/ioutil"
+)
+
+// Buffer reads the response body once into memory. Every later Get*, Expect* or
+// Proxy call reads from the start of that snapshot, so a chain can extract the body
+// as many times as it needs, even with calls like ProxyContext that would otherwise
+// consume it.
+func (r *Response) Buffer() *Response {
+	if r.req.err != nil || r.buffered {
+		return r
+	}
+	b, err := r.readBody()
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	r.snapshot, r.buffered = b, true
+	r.rewindBody()
+	return r
+}
+
+// rewindBody resets the body to the start of the snapshot taken by Buffer
+func (r *Response) rewindBody() {
+	if r.buffered {
+		r.Response.Body = ioutil.NopCloser(bytes.NewReader(r.snapshot))
+	}
+}
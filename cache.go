@@ -0,0 +1,293 @@
+package quest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseCache is an in-memory cache of GET responses shared by a Client's requests.
+// Responses with a Vary header are stored as variants of the same key.
+type responseCache struct {
+	mu          sync.Mutex
+	entries     map[string][]*cacheEntry
+	size        int
+	maxEntries  int
+	negativeTTL time.Duration
+}
+
+type cacheEntry struct {
+	status   int
+	header   http.Header
+	body     []byte
+	expires  time.Time
+	negative bool
+	// shared is set when the response may be served to requests with credentials
+	shared bool
+	// vary holds digests of the request headers named by the Vary header and of
+	// the credential headers
+	vary map[string]string
+}
+
+// Cache makes the client cache GET responses in memory for as long as their
+// Cache-Control or Expires headers allow. The cache is shared by every request of
+// the client, so private responses are not stored, and responses to requests with
+// credentials (Authorization, Cookie or a ScopedHeader) only when they are marked
+// public or have an s-maxage, and then only for the same credentials. A response
+// with a Vary header is only used for requests with the same values for the
+// headers it names. At most maxEntries
+// responses are kept; zero means no limit.
+func (c *Client) Cache(maxEntries int) *Client {
+	c.responseCache().maxEntries = maxEntries
+	return c
+}
+
+// NegativeCache makes the client cache 404 and 410 responses to GET requests for
+// ttl, so repeated lookups of missing resources are answered from the cache.
+// Responses with Cache-Control: no-store or private are never cached.
+func (c *Client) NegativeCache(ttl time.Duration) *Client {
+	c.responseCache().negativeTTL = ttl
+	return c
+}
+
+// FromCache reports whether the response was served from the client's cache
+func (r *Response) FromCache() bool {
+	return r.fromCache
+}
+
+// reportCache emits whether a request to host was answered from the cache
+func (c *Client) reportCache(host string, entry *cacheEntry) {
+	labels := map[string]string{"host": host}
+	switch {
+	case entry == nil:
+		c.emit(Metric{Name: MetricCacheMisses, Value: 1, Labels: labels})
+	case entry.negative:
+		c.emit(Metric{Name: MetricNegativeCacheHits, Value: 1, Labels: labels})
+	default:
+		c.emit(Metric{Name: MetricCacheHits, Value: 1, Labels: labels})
+	}
+}
+
+func (c *Client) responseCache() *responseCache {
+	if c.cache == nil {
+		c.cache = &responseCache{entries: map[string][]*cacheEntry{}}
+	}
+	return c.cache
+}
+
+// cacheable reports whether req can be answered from or stored in the cache
+func (c *responseCache) cacheable(req *http.Request) bool {
+	return req.Method == http.MethodGet && req.Header.Get("Range") == ""
+}
+
+// credentialHeaders returns the request headers that identify who sends a request
+func (c *Client) credentialHeaders() []string {
+	names := []string{"Authorization", "Proxy-Authorization", "Cookie"}
+	for _, h := range c.scopedHeaders {
+		names = append(names, h.key)
+	}
+	return names
+}
+
+// hasCredentials reports whether req has a value for any of the credential headers
+func hasCredentials(req *http.Request, credentials []string) bool {
+	for _, name := range credentials {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedWithCredentials reports whether a shared cache may serve a response to
+// requests with credentials
+func sharedWithCredentials(header http.Header) bool {
+	directives := cacheControl(header)
+	_, public := directives["public"]
+	_, sMaxAge := directives["s-maxage"]
+	return public || sMaxAge
+}
+
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+// varyValues returns digests of the request headers named by the Vary header of a
+// response and of the credential headers, so a response is only served to the
+// principal it was stored for even when the upstream does not send Vary for them.
+// ok is false for "Vary: *", which matches no other request.
+func varyValues(req *http.Request, header http.Header, credentials []string) (values map[string]string, ok bool) {
+	values = map[string]string{}
+	for _, name := range credentials {
+		name = http.CanonicalHeaderKey(name)
+		values[name] = headerDigest(req, name)
+	}
+	for _, line := range header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return nil, false
+			}
+			if name == "" {
+				continue
+			}
+			values[name] = headerDigest(req, name)
+		}
+	}
+	return values, true
+}
+
+// headerDigest returns a digest of the values of a request header, so credentials
+// are not kept in memory by the cache
+func headerDigest(req *http.Request, name string) string {
+	sum := sha256.Sum256([]byte(strings.Join(req.Header.Values(name), ", ")))
+	return string(sum[:])
+}
+
+// matches reports whether req has the same values for the Vary and credential
+// headers as the request the entry was stored for
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for name, value := range e.vary {
+		if headerDigest(req, name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns a cached response for req. credentials are the headers that
+// identify who sends it.
+func (c *responseCache) get(req *http.Request, now time.Time, credentials []string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := cacheKey(req)
+	credentialed := hasCredentials(req, credentials)
+	for _, entry := range c.entries[key] {
+		if !entry.matches(req) || (credentialed && !entry.shared) {
+			continue
+		}
+		if !now.Before(entry.expires) {
+			c.remove(key, entry)
+			return nil, false
+		}
+		return entry, true
+	}
+	return nil, false
+}
+
+// store caches resp if its headers (or the negative cache) allow a shared cache to
+// store it
+func (c *responseCache) store(req *http.Request, resp *Response, now time.Time, credentials []string) {
+	shared := sharedWithCredentials(resp.Header)
+	if hasCredentials(req, credentials) && !shared {
+		return
+	}
+
+	var ttl time.Duration
+	negative := resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone
+	if negative {
+		directives := cacheControl(resp.Header)
+		_, noStore := directives["no-store"]
+		_, private := directives["private"]
+		if noStore || private || c.negativeTTL <= 0 {
+			return
+		}
+		ttl = c.negativeTTL
+	} else {
+		if resp.StatusCode != http.StatusOK {
+			return
+		}
+		lifetime, ok := freshness(resp.Header, true, now)
+		if !ok {
+			return
+		}
+		ttl = lifetime
+	}
+
+	vary, ok := varyValues(req, resp.Header, credentials)
+	if !ok {
+		return
+	}
+	body, err := resp.readBody()
+	if err != nil {
+		return
+	}
+	entry := &cacheEntry{
+		status:   resp.StatusCode,
+		header:   resp.Header.Clone(),
+		body:     body,
+		expires:  now.Add(ttl),
+		negative: negative,
+		shared:   shared,
+		vary:     vary,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := cacheKey(req)
+	for _, old := range c.entries[key] {
+		if old.matches(req) {
+			c.remove(key, old)
+			break
+		}
+	}
+	if c.maxEntries > 0 && c.size >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = append(c.entries[key], entry)
+	c.size++
+}
+
+// remove deletes entry, a variant stored under key
+func (c *responseCache) remove(key string, entry *cacheEntry) {
+	variants := c.entries[key]
+	for i, e := range variants {
+		if e == entry {
+			variants = append(variants[:i], variants[i+1:]...)
+			c.size--
+			break
+		}
+	}
+	if len(variants) == 0 {
+		delete(c.entries, key)
+		return
+	}
+	c.entries[key] = variants
+}
+
+// evict removes expired entries, or arbitrary ones if none have expired
+func (c *responseCache) evict(now time.Time) {
+	for key, variants := range c.entries {
+		for _, entry := range append([]*cacheEntry(nil), variants...) {
+			if !now.Before(entry.expires) {
+				c.remove(key, entry)
+			}
+		}
+	}
+	for key, variants := range c.entries {
+		if c.size < c.maxEntries {
+			return
+		}
+		c.remove(key, variants[0])
+	}
+}
+
+// response builds an *http.Response from a cached entry
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
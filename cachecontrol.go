@@ -0,0 +1,103 @@
+package quest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl parses a Cache-Control header into its directives. Directives
+// without a value map to an empty string.
+func cacheControl(header http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, value := range header["Cache-Control"] {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			kv := strings.SplitN(part, "=", 2)
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			if len(kv) == 2 {
+				directives[key] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			} else {
+				directives[key] = ""
+			}
+		}
+	}
+	return directives
+}
+
+// freshness returns how long a cache may serve the response without revalidating.
+// A shared cache (e.g. a CDN) may not store private responses and prefers
+// s-maxage. ok is false when the response may not be cached. now is used for
+// Expires when the response has no Date header.
+func freshness(header http.Header, shared bool, now time.Time) (lifetime time.Duration, ok bool) {
+	directives := cacheControl(header)
+	uncacheable := []string{"no-store", "no-cache"}
+	ages := []string{"max-age"}
+	if shared {
+		uncacheable = append(uncacheable, "private")
+		ages = []string{"s-maxage", "max-age"}
+	}
+	for _, directive := range uncacheable {
+		if _, found := directives[directive]; found {
+			return 0, false
+		}
+	}
+	for _, directive := range ages {
+		if value, found := directives[directive]; found {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if value := header.Get("Expires"); value != "" {
+		expires, err := http.ParseTime(value)
+		if err != nil {
+			return 0, false
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		if lifetime = expires.Sub(date); lifetime > 0 {
+			return lifetime, true
+		}
+	}
+	return 0, false
+}
+
+// ExpectCacheable will error unless Cache-Control (or Expires) allows shared caches
+// to serve the response for at least maxAge
+func (r *Response) ExpectCacheable(maxAge time.Duration) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	lifetime, ok := freshness(r.Response.Header, true, r.req.clock().Now())
+	if !ok || lifetime < maxAge {
+		err := fmt.Errorf("Invalid Caching. Expected to be cacheable for at least %s, got Cache-Control %q and Expires %q",
+			maxAge, r.Response.Header.Get("Cache-Control"), r.Response.Header.Get("Expires"))
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	return r
+}
+
+// ExpectNotCacheable will error if Cache-Control (or Expires) allows shared caches
+// to serve the response without revalidating
+func (r *Response) ExpectNotCacheable() *Response {
+	if r.req.err != nil {
+		return r
+	}
+	if lifetime, ok := freshness(r.Response.Header, true, r.req.clock().Now()); ok {
+		err := fmt.Errorf("Invalid Caching. Expected not to be cacheable, got cacheable for %s", lifetime)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	return r
+}
@@ -0,0 +1,112 @@
+package quest
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Capture stores several parts of the response into the fields of the struct that
+// into points to, reading the body only once. Fields are selected with a `quest`
+// struct tag:
+//
+//	type result struct {
+//		Status int      `quest:"status"`
+//		ETag   string   `quest:"header:ETag"`
+//		Links  []string `quest:"header:Link"`
+//		User   User     `quest:"body"`
+//	}
+//
+// Header fields may be a string, []string or int. A body field that is a string or
+// []byte receives the raw body, any other type is decoded from JSON. Unexported
+// fields are skipped.
+func (r *Response) Capture(into interface{}) *Response {
+	if r.req.err != nil {
+		return r
+	}
+
+	v := reflect.ValueOf(into)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		err := fmt.Errorf("Invalid Capture. Expected a pointer to a struct, got %T", into)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	v = v.Elem()
+
+	var body []byte
+	var bodyRead bool
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag, ok := field.Tag.Lookup("quest")
+		if !ok || tag == "" || tag == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		var err error
+		switch {
+		case tag == "status":
+			err = setCaptureInt(v.Field(i), strconv.Itoa(r.Response.StatusCode))
+		case strings.HasPrefix(tag, "header:"):
+			err = r.captureHeader(v.Field(i), strings.TrimPrefix(tag, "header:"))
+		case tag == "body":
+			if !bodyRead {
+				body, err = r.readBody()
+				bodyRead = true
+			}
+			if err == nil {
+				err = captureBody(r.req.json(), v.Field(i), body)
+			}
+		default:
+			err = fmt.Errorf("unknown tag %q", tag)
+		}
+		if err != nil {
+			err = fmt.Errorf("Invalid Capture. Field %q: %v", field.Name, err)
+			r.req.err = handleResponseError(err, r.req, r)
+			return r
+		}
+	}
+	return r
+}
+
+func (r *Response) captureHeader(field reflect.Value, key string) error {
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+		values := r.Response.Header[http.CanonicalHeaderKey(key)]
+		field.Set(reflect.ValueOf(append([]string(nil), values...)).Convert(field.Type()))
+		return nil
+	}
+	value := r.Response.Header.Get(key)
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+	return setCaptureInt(field, value)
+}
+
+func setCaptureInt(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", value)
+		}
+		field.SetInt(n)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", field.Type())
+}
+
+func captureBody(api jsoniter.API, field reflect.Value, body []byte) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(string(body))
+		return nil
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8:
+		field.SetBytes(append([]byte(nil), body...))
+		return nil
+	}
+	return api.Unmarshal(body, field.Addr().Interface())
+}
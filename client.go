@@ -0,0 +1,257 @@
+package quest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client holds configuration that is shared by every request it creates
+type Client struct {
+	limiter    *limiter
+	metrics    MetricsHook
+	rateLimits *rateLimits
+	tokens     *tokenBuckets
+	throttle   *throttle
+	transport  *http.Transport
+	dial       *dialer
+
+	redirectHosts []string
+	scopedHeaders []scopedHeader
+	paramSyntax   ParamSyntax
+	clock         Clock
+	rand          *lockedRand
+	signer        Signer
+	skew          clockSkew
+	proxyURL      *url.URL
+	proxyUser     *url.Userinfo
+	decompress    decompressLimits
+	allowedHosts  []string
+	tls           tlsPolicy
+	headerLint    func(HeaderWarning)
+	strictHeaders bool
+	noRedirects   bool
+	naming        *NamingStrategy
+	jsonOpts      *JSONOptions
+	log           requestLogger
+	mirror        *mirror
+	inFlight      inFlight
+	accept        string
+	phases        phaseTimeouts
+	cache         *responseCache
+	breakers      *breakers
+	baseURL       *url.URL
+	configErr     error
+	headers       map[string]string
+	roundTripper  http.RoundTripper
+	maxURLLength  int
+	urlValidators []URLValidator
+	formOpts      *FormOptions
+	derived       derivedTransports
+	headerLimit   int64
+}
+
+// NewClient creates a new client
+func NewClient() *Client {
+	c := &Client{}
+	c.limiter = &limiter{report: c.reportLimiter}
+	return c
+}
+
+// New creates a new request with given http method and path (uri) that is sent
+// through this client
+func (c *Client) New(method, path string) *Request {
+	req := New(method, path)
+	req.client = c
+	if req.err == nil && c.configErr != nil {
+		req.err = handleRequestError(c.configErr, req)
+	}
+	if req.err == nil && c.baseURL != nil {
+		req.URL = c.resolve(req.URL)
+	}
+	if req.err == nil && c.accept != "" {
+		req.headers["Accept"] = c.accept
+	}
+	if req.err == nil {
+		for key, value := range c.headers {
+			req.headers[key] = value
+		}
+	}
+	if req.err == nil && req.URL.Host != "" {
+		if err := c.checkHost(req.URL); err != nil {
+			req.err = handleRequestError(err, req)
+		}
+	}
+	return req
+}
+
+// BaseURL sets the URL that relative request paths are resolved against, e.g. with a
+// base URL of "https://api.example.com/v1" the path "/users/:id" is sent to
+// "https://api.example.com/v1/users/:id". Absolute URLs are sent as is.
+func (c *Client) BaseURL(rawURL string) *Client {
+	u, err := url.Parse(rawURL)
+	if err == nil && (u.Scheme == "" || u.Host == "") {
+		err = errors.New("expected an absolute url")
+	}
+	if err != nil {
+		c.configErr = fmt.Errorf("error parsing base url %q: %v", rawURL, err)
+		return c
+	}
+	c.baseURL = u
+	return c
+}
+
+// Header sets a header that is sent with every request created by this client. The
+// request's own headers take precedence.
+func (c *Client) Header(key, value string) *Client {
+	if c.headers == nil {
+		c.headers = make(map[string]string)
+	}
+	c.headers[key] = value
+	return c
+}
+
+// Timeout sets the default for how long each request of this client may take,
+// including reading the response body. See Request.Timeout.
+func (c *Client) Timeout(d time.Duration) *Client {
+	c.phases.request = d
+	return c
+}
+
+// Transport sets the http.RoundTripper this client's requests are sent with. An
+// *http.Transport is used directly, so options like Proxy or KeepAlive configure
+// it; any other RoundTripper is used as is unless such an option replaces it.
+func (c *Client) Transport(rt http.RoundTripper) *Client {
+	c.derived.reset()
+	if t, ok := rt.(*http.Transport); ok {
+		c.transport, c.roundTripper = t, nil
+		return c
+	}
+	c.roundTripper = rt
+	return c
+}
+
+// resolve returns u resolved against the client's base URL
+func (c *Client) resolve(u *url.URL) *url.URL {
+	if u.IsAbs() || u.Host != "" {
+		return u
+	}
+	resolved := *c.baseURL
+	resolved.Path = strings.TrimSuffix(resolved.Path, "/") + "/" + strings.TrimPrefix(u.Path, "/")
+	resolved.RawPath = ""
+	if u.RawQuery != "" {
+		resolved.RawQuery = u.RawQuery
+	}
+	resolved.Fragment = u.Fragment
+	return &resolved
+}
+
+// Get creates a new http "GET" request for path (uri) on this client
+func (c *Client) Get(path string) *Request {
+	return c.New(http.MethodGet, path)
+}
+
+// Post creates a new http "POST" request for path (uri) on this client
+func (c *Client) Post(path string) *Request {
+	return c.New(http.MethodPost, path)
+}
+
+// Put creates a new http "Put" request for path (uri) on this client
+func (c *Client) Put(path string) *Request {
+	return c.New(http.MethodPut, path)
+}
+
+// Delete creates a new http "Delete" request for path (uri) on this client
+func (c *Client) Delete(path string) *Request {
+	return c.New(http.MethodDelete, path)
+}
+
+// MaxConcurrent limits the number of requests this client will have in flight at
+// once. A request holds its slot until its response body is closed. Requests over
+// the limit wait in a queue until a slot frees up. A value of zero (the default)
+// means no limit.
+func (c *Client) MaxConcurrent(n int) *Client {
+	c.limiter.setMax(n)
+	return c
+}
+
+// QueueTimeout sets how long a request may wait in the MaxConcurrent queue before
+// failing with ErrQueueTimeout. A value of zero (the default) waits until the
+// request's context is done.
+func (c *Client) QueueTimeout(d time.Duration) *Client {
+	c.limiter.setTimeout(d)
+	return c
+}
+
+// WithMetrics sets the hook that receives metrics emitted by this client
+func (c *Client) WithMetrics(hook MetricsHook) *Client {
+	c.metrics = hook
+	return c
+}
+
+// InFlight returns the number of requests currently being sent by this client
+func (c *Client) InFlight() int {
+	inFlight, _ := c.limiter.counts()
+	return inFlight
+}
+
+// Queued returns the number of requests waiting for a MaxConcurrent slot
+func (c *Client) Queued() int {
+	_, queued := c.limiter.counts()
+	return queued
+}
+
+// wait blocks until a request to host may be sent according to the client's rate
+// limit and throttle
+func (c *Client) wait(ctx context.Context, host string) error {
+	if c.tokens != nil {
+		if err := c.tokens.wait(ctx, c.getClock(), host); err != nil {
+			return err
+		}
+	}
+	if c.rateLimits != nil {
+		if err := c.rateLimits.wait(ctx, c.getClock(), host); err != nil {
+			return err
+		}
+	}
+	if c.throttle != nil {
+		if err := c.throttle.wait(ctx, c.getClock(), host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observe records a response from host for the client's rate limit and throttle
+func (c *Client) observe(host string, resp *Response) {
+	if c.rateLimits != nil {
+		c.rateLimits.observe(host, resp)
+	}
+	if c.throttle != nil {
+		c.throttle.observe(host, resp.StatusCode)
+	}
+}
+
+// httpTransport returns the transport used by this client's requests, creating it
+// from http.DefaultTransport on first use
+func (c *Client) httpTransport() *http.Transport {
+	if c.transport == nil {
+		c.transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	return c.transport
+}
+
+func (c *Client) reportLimiter(inFlight, queued int) {
+	c.emit(Metric{Name: MetricInFlight, Value: float64(inFlight)})
+	c.emit(Metric{Name: MetricQueued, Value: float64(queued)})
+}
+
+func (c *Client) emit(m Metric) {
+	if c.metrics != nil {
+		c.metrics(m)
+	}
+}
@@ -0,0 +1,177 @@
+package quest
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Clock tells the current time and waits for time to pass. It can be replaced to
+// control time in tests so that waits (rate limits, throttling, backoff,
+// Retry-After) are instant and deterministic and cache entries and breakers expire
+// on demand. See FakeClock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock backed by the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// FakeClock is a Clock for tests whose time only moves when Advance is called
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFakeClock creates a FakeClock set to now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the fake time
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the fake time once it has been advanced by
+// at least d
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the fake time forward by d, firing the channels of After calls
+// that are due
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiting
+}
+
+// WithClock sets the clock used by this client, e.g. for signing requests, waiting
+// on rate limits and retries and expiring cache entries
+func (c *Client) WithClock(clock Clock) *Client {
+	c.clock = clock
+	return c
+}
+
+// WithClock sets the clock used by this request, overriding the client's
+func (r *Request) WithClock(clock Clock) *Request {
+	r.clockOverride = clock
+	return r
+}
+
+// WithRand sets the random source used for jitter (e.g. in backoff) by this client.
+// It is safe to share the source between concurrent requests.
+func (c *Client) WithRand(rnd *rand.Rand) *Client {
+	c.rand = &lockedRand{rnd: rnd}
+	return c
+}
+
+// WithRand sets the random source used for jitter by this request, overriding the
+// client's
+func (r *Request) WithRand(rnd *rand.Rand) *Request {
+	r.randOverride = &lockedRand{rnd: rnd}
+	return r
+}
+
+// getClock returns the client's clock
+func (c *Client) getClock() Clock {
+	if c.clock != nil {
+		return c.clock
+	}
+	return systemClock{}
+}
+
+// clock returns the clock used by the request
+func (r *Request) clock() Clock {
+	if r.clockOverride != nil {
+		return r.clockOverride
+	}
+	if r.client != nil {
+		return r.client.getClock()
+	}
+	return systemClock{}
+}
+
+// random returns a pseudo-random number in [0.0,1.0) from the request's source
+func (r *Request) random() float64 {
+	if r.randOverride != nil {
+		return r.randOverride.Float64()
+	}
+	if r.client != nil && r.client.rand != nil {
+		return r.client.rand.Float64()
+	}
+	return rand.Float64()
+}
+
+// lockedRand makes a *rand.Rand safe for concurrent use
+type lockedRand struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rnd.Float64()
+}
+
+// sleep waits for d to pass on clock or until ctx is done
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	elapsed, stop := after(clock, d)
+	defer stop()
+	select {
+	case <-elapsed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// after is like clock.After, but the timer of the system clock is freed by stop
+// instead of when it fires
+func after(clock Clock, d time.Duration) (<-chan time.Time, func()) {
+	if _, ok := clock.(systemClock); ok {
+		timer := time.NewTimer(d)
+		return timer.C, func() { timer.Stop() }
+	}
+	return clock.After(d), func() {}
+}
@@ -0,0 +1,186 @@
+package quest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// DefaultAccept is the Accept header sent by new requests
+var DefaultAccept = "application/json"
+
+// Encoder encodes value as a request body
+type Encoder func(w io.Writer, value interface{}) error
+
+// Decoder decodes a response body into into
+type Decoder func(body io.Reader, into interface{}) error
+
+// Codec encodes request bodies and decodes response bodies of a media type. Either
+// function may be nil if the codec only works in one direction.
+type Codec struct {
+	Encode Encoder
+	Decode Decoder
+}
+
+var codecs = struct {
+	sync.RWMutex
+	m map[string]Codec
+}{m: map[string]Codec{
+	"application/xml": {encodeXML, decodeXML},
+	"text/xml":        {encodeXML, decodeXML},
+	"text/csv":        {encodeCSV, decodeCSV},
+}}
+
+// RegisterCodec registers the codec BodyAs and GetAuto use for the given media type
+// (e.g. "application/vnd.api+json" or "application/cbor"). Registering
+// "application/json" replaces the default JSON encoding of JSONBody and decoding
+// of GetJSON too; the request's JSON naming and encoding options then no longer
+// apply.
+func RegisterCodec(mediaType string, codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.m[strings.ToLower(mediaType)] = codec
+}
+
+// RegisterDecoder registers the decoder GetAuto uses for responses with the given
+// media type, keeping the media type's encoder if it has one
+func RegisterDecoder(mediaType string, dec Decoder) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	mediaType = strings.ToLower(mediaType)
+	codec := codecs.m[mediaType]
+	codec.Decode = dec
+	codecs.m[mediaType] = codec
+}
+
+// lookupCodec returns the codec for mediaType, falling back to its structured
+// syntax suffix (e.g. application/problem+xml uses the application/xml codec)
+func lookupCodec(mediaType string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	if codec, ok := codecs.m[mediaType]; ok {
+		return codec, true
+	}
+	if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+		codec, ok := codecs.m["application/"+mediaType[i+1:]]
+		return codec, ok
+	}
+	return Codec{}, false
+}
+
+// isJSON reports whether mediaType is JSON or uses the +json suffix
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Accept sets the Accept header for every request from this client
+func (c *Client) Accept(value string) *Client {
+	c.accept = value
+	return c
+}
+
+// BodyAs encodes value with the codec registered for contentType and sets it as
+// the body of the request. JSON media types without a registered codec are
+// encoded like JSONBody.
+func (r *Request) BodyAs(contentType string, value interface{}) *Request {
+	if r.err != nil {
+		return r
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		r.err = handleRequestError(err, r)
+		return r
+	}
+
+	codec, ok := lookupCodec(mediaType)
+	if !ok || codec.Encode == nil {
+		if !isJSON(mediaType) {
+			r.err = handleRequestError(fmt.Errorf("no encoder registered for %q", mediaType), r)
+			return r
+		}
+		codec.Encode = func(w io.Writer, value interface{}) error {
+			b, err := r.marshalJSON(value, r.jsonOptions().Indent)
+			if err == nil {
+				_, err = w.Write(b)
+			}
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, value); err != nil {
+		r.err = handleRequestError(err, r)
+		return r
+	}
+	r.Header("Content-Type", contentType)
+	return r.Body(&buf)
+}
+
+// GetAuto decodes the response body into into based on the Content-Type the server
+// returned, with the codec registered for it. JSON is decoded like GetJSON, XML
+// with encoding/xml and CSV into a *[][]string.
+func (r *Response) GetAuto(into interface{}) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	contentType := r.Response.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		err = fmt.Errorf("Invalid Content-Type. Expected a media type, got %q", contentType)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+
+	codec, ok := lookupCodec(mediaType)
+	if !ok || codec.Decode == nil {
+		if isJSON(mediaType) {
+			return r.GetJSON(into)
+		}
+		err = fmt.Errorf("Invalid Content-Type. Expected a registered media type, got %q", mediaType)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+
+	b, err := r.readBody()
+	if err == nil {
+		err = codec.Decode(bytes.NewReader(b), into)
+	}
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+	}
+	return r
+}
+
+func encodeXML(w io.Writer, value interface{}) error {
+	return xml.NewEncoder(w).Encode(value)
+}
+
+func decodeXML(body io.Reader, into interface{}) error {
+	return xml.NewDecoder(body).Decode(into)
+}
+
+func encodeCSV(w io.Writer, value interface{}) error {
+	records, ok := value.([][]string)
+	if !ok {
+		return fmt.Errorf("cannot encode %T as csv, expected [][]string", value)
+	}
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+func decodeCSV(body io.Reader, into interface{}) error {
+	records, ok := into.(*[][]string)
+	if !ok {
+		return fmt.Errorf("cannot decode csv into %T, expected *[][]string", into)
+	}
+	all, err := csv.NewReader(body).ReadAll()
+	if err != nil {
+		return err
+	}
+	*records = all
+	return nil
+}
@@ -0,0 +1,44 @@
+package quest
+
+import "errors"
+
+// ErrCollectLimit is returned by CollectAll along with the items collected so far
+// when the item or page cap was reached before the last page
+var ErrCollectLimit = errors.New("collect limit reached before the last page")
+
+// PageExtractor extracts the items of one page from its response and returns the
+// request for the next page, or nil when there are no more pages
+type PageExtractor[T any] func(resp *Response) (items []T, next *Request, err error)
+
+// CollectAll sends req and keeps requesting the next page returned by extract until
+// there are no more pages, appending every page's items into one slice.
+//
+// maxItems and maxPages cap how much is collected (zero means no cap). When a cap is
+// hit the items collected so far are returned with ErrCollectLimit.
+func CollectAll[T any](req *Request, extract PageExtractor[T], maxItems, maxPages int) ([]T, error) {
+	var all []T
+	for pages := 0; req != nil; pages++ {
+		if maxPages > 0 && pages >= maxPages {
+			return all, ErrCollectLimit
+		}
+
+		resp := req.Send()
+		items, next, err := extract(resp)
+		if err == nil {
+			err = resp.Done()
+		}
+		if err != nil {
+			return all, err
+		}
+
+		all = append(all, items...)
+		if maxItems > 0 && len(all) >= maxItems {
+			if len(all) > maxItems || next != nil {
+				return all[:maxItems], ErrCollectLimit
+			}
+			return all, nil
+		}
+		req = next
+	}
+	return all, nil
+}
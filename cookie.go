@@ -0,0 +1,78 @@
+package quest
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Cookie adds a cookie to the request, e.g. a session cookie captured from an
+// earlier response with GetCookie
+func (r *Request) Cookie(cookie *http.Cookie) *Request {
+	if r.err != nil {
+		return r
+	}
+	value := (&http.Cookie{Name: cookie.Name, Value: cookie.Value}).String()
+	if existing := r.headers["Cookie"]; existing != "" {
+		value = existing + "; " + value
+	}
+	r.headers["Cookie"] = value
+	return r
+}
+
+// cookie returns the last cookie with name set by the response
+func (r *Response) cookie(name string) *http.Cookie {
+	var found *http.Cookie
+	for _, c := range r.Response.Cookies() {
+		if c.Name == name {
+			found = c
+		}
+	}
+	return found
+}
+
+// ExpectCookie will error unless the response sets a cookie with name that is not
+// already expired (i.e. it does not delete the cookie)
+func (r *Response) ExpectCookie(name string) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	c := r.cookie(name)
+	if c == nil {
+		err := fmt.Errorf("Invalid Cookie. Expected %q cookie to be set, got none", name)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	if c.MaxAge < 0 || (!c.Expires.IsZero() && !c.Expires.After(r.req.clock().Now())) {
+		err := fmt.Errorf("Invalid Cookie. Expected %q cookie to be set, got it expired", name)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	return r
+}
+
+// GetCookie stores the cookie with name set by the response, with its attributes
+// (expiry, Secure, SameSite, ...), into into
+func (r *Response) GetCookie(name string, into *http.Cookie) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	c := r.cookie(name)
+	if c == nil {
+		err := fmt.Errorf("Invalid Cookie. Expected %q cookie to be set, got none", name)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	*into = *c
+	return r
+}
+
+// GetCookieValue stores the value of the cookie with name set by the response into
+// into
+func (r *Response) GetCookieValue(name string, into *string) *Response {
+	var c http.Cookie
+	if r.GetCookie(name, &c).req.err != nil {
+		return r
+	}
+	*into = c.Value
+	return r
+}
@@ -0,0 +1,146 @@
+package quest
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// GetCSV decodes a CSV response body into into, one []string per record including
+// the header row, regardless of the Content-Type the server returned
+func (r *Response) GetCSV(into *[][]string) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	b, err := r.readBody()
+	if err == nil {
+		err = decodeCSV(bytes.NewReader(b), into)
+	}
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+	}
+	return r
+}
+
+// GetCSVRecords decodes a CSV response body into into, a pointer to a slice of
+// structs. The first record is the header and each column is stored in the field
+// whose `csv` tag (or name, ignoring case) matches it; columns without a field are
+// skipped and a tag of "-" ignores a field. Fields may be strings, numbers, bools
+// or implement encoding.TextUnmarshaler.
+func (r *Response) GetCSVRecords(into interface{}) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	slice := reflect.ValueOf(into)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice || slice.Elem().Type().Elem().Kind() != reflect.Struct {
+		err := fmt.Errorf("cannot decode csv into %T, expected a pointer to a slice of structs", into)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+
+	var records [][]string
+	if r.GetCSV(&records); r.req.err != nil {
+		return r
+	}
+	if len(records) == 0 {
+		slice.Elem().SetLen(0)
+		return r
+	}
+
+	itemType := slice.Elem().Type().Elem()
+	fields := csvFields(itemType, records[0])
+	items := reflect.MakeSlice(slice.Elem().Type(), 0, len(records)-1)
+	for line, record := range records[1:] {
+		item := reflect.New(itemType).Elem()
+		for column, value := range record {
+			index, ok := fields[column]
+			if !ok {
+				continue
+			}
+			if err := setCSVField(item.FieldByIndex(index), value); err != nil {
+				err = fmt.Errorf("Invalid CSV. Expected column %q of record %d to be a %s, got %q: %v", records[0][column], line+1, item.FieldByIndex(index).Type(), value, err)
+				r.req.err = handleResponseError(err, r.req, r)
+				return r
+			}
+		}
+		items = reflect.Append(items, item)
+	}
+	slice.Elem().Set(items)
+	return r
+}
+
+// csvFields maps the columns of header to the fields of t they are stored in
+func csvFields(t reflect.Type, header []string) map[int][]int {
+	byName := map[string][]int{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("csv"); ok {
+			if tag = strings.Split(tag, ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+		}
+		byName[strings.ToLower(name)] = field.Index
+	}
+
+	fields := map[int][]int{}
+	for column, name := range header {
+		if column == 0 {
+			// a byte order mark is common in exports from spreadsheets
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		if index, ok := byName[strings.ToLower(strings.TrimSpace(name))]; ok {
+			fields[column] = index
+		}
+	}
+	return fields
+}
+
+// setCSVField parses value into field
+func setCSVField(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	if field.Kind() == reflect.Ptr {
+		if value == "" {
+			return nil
+		}
+		field.Set(reflect.New(field.Type().Elem()))
+		return setCSVField(field.Elem(), value)
+	}
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+	if value == "" {
+		// an empty cell leaves the field at its zero value
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		field.SetBool(b)
+		return err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		field.SetInt(n)
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		field.SetUint(n)
+		return err
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, field.Type().Bits())
+		field.SetFloat(n)
+		return err
+	}
+	return fmt.Errorf("unsupported field type %s", field.Type())
+}
@@ -0,0 +1,52 @@
+package quest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+)
+
+// Debug dumps every request sent (including redirects and retries) and every
+// response received to w in wire format, with bodies. The response body is
+// buffered so it can still be read, e.g. by GetJSON. Secrets are hidden, see
+// RedactHeaders and RedactPattern.
+func (r *Request) Debug(w io.Writer) *Request {
+	r.debug = w
+	return r
+}
+
+// dumpTransport writes the requests and responses that pass through it to w
+type dumpTransport struct {
+	base http.RoundTripper
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		t.write(dump)
+	} else {
+		t.write([]byte(fmt.Sprintf("[Quest]: could not dump request: %v\n", err)))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.write([]byte(fmt.Sprintf("[Quest]: %v\n", err)))
+		return resp, err
+	}
+	if dump, err := httputil.DumpResponse(resp, true); err == nil {
+		t.write(dump)
+	} else {
+		t.write([]byte(fmt.Sprintf("[Quest]: could not dump response: %v\n", err)))
+	}
+	return resp, nil
+}
+
+func (t *dumpTransport) write(dump []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.w.Write(redactDump(dump))
+	t.w.Write([]byte("\n\n"))
+}
@@ -0,0 +1,177 @@
+package quest
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ratioThreshold is how much has to be decompressed before the compression ratio
+// limit is enforced, so small but very compressible bodies are not rejected
+const ratioThreshold = 1 << 20
+
+// DecompressionError is returned while reading a compressed response body that
+// expands past the configured MaxDecompressedSize or MaxCompressionRatio
+type DecompressionError struct {
+	Compressed   int64
+	Decompressed int64
+	MaxSize      int64
+	MaxRatio     float64
+}
+
+func (e *DecompressionError) Error() string {
+	if e.MaxSize > 0 && e.Decompressed > e.MaxSize {
+		return fmt.Sprintf("decompressed body exceeds %d bytes", e.MaxSize)
+	}
+	return fmt.Sprintf("decompressed body exceeds compression ratio %.0f (%d bytes from %d)", e.MaxRatio, e.Decompressed, e.Compressed)
+}
+
+// decompressLimits bounds how far a compressed response body may expand
+type decompressLimits struct {
+	maxSize  int64
+	maxRatio float64
+}
+
+// MaxDecompressedSize fails reading a compressed response body once it expands past
+// n bytes
+func (r *Request) MaxDecompressedSize(n int64) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.decompress.maxSize = n
+	return r
+}
+
+// MaxCompressionRatio fails reading a compressed response body once it expands past
+// ratio times its compressed size. It is enforced after 1MB has been decompressed.
+func (r *Request) MaxCompressionRatio(ratio float64) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.decompress.maxRatio = ratio
+	return r
+}
+
+// MaxDecompressedSize sets MaxDecompressedSize for every request from this client
+func (c *Client) MaxDecompressedSize(n int64) *Client {
+	c.decompress.maxSize = n
+	return c
+}
+
+// MaxCompressionRatio sets MaxCompressionRatio for every request from this client
+func (c *Client) MaxCompressionRatio(ratio float64) *Client {
+	c.decompress.maxRatio = ratio
+	return c
+}
+
+// decompressLimits returns the request's limits, falling back to the client's
+func (r *Request) decompressLimits() decompressLimits {
+	limits := r.decompress
+	if r.client != nil {
+		if limits.maxSize <= 0 {
+			limits.maxSize = r.client.decompress.maxSize
+		}
+		if limits.maxRatio <= 0 {
+			limits.maxRatio = r.client.decompress.maxRatio
+		}
+	}
+	return limits
+}
+
+func (l decompressLimits) enabled() bool {
+	return l.maxSize > 0 || l.maxRatio > 0
+}
+
+// decompressResponse replaces a gzip or deflate encoded body with a bounded
+// decompressing reader, the same way net/http transparently decompresses gzip
+func decompressResponse(resp *http.Response, limits decompressLimits) {
+	var newReader func(io.Reader) (io.ReadCloser, error)
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip":
+		newReader = func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		}
+	case "deflate":
+		newReader = func(r io.Reader) (io.ReadCloser, error) {
+			return flate.NewReader(r), nil
+		}
+	default:
+		return
+	}
+
+	resp.Body = &boundedDecompressor{
+		body:      resp.Body,
+		newReader: newReader,
+		limits:    limits,
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// boundedDecompressor decompresses a body and fails once it expands too far
+type boundedDecompressor struct {
+	body         io.ReadCloser
+	newReader    func(io.Reader) (io.ReadCloser, error)
+	limits       decompressLimits
+	reader       io.ReadCloser
+	compressed   int64
+	decompressed int64
+	err          error
+}
+
+func (d *boundedDecompressor) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.reader == nil {
+		d.reader, d.err = d.newReader(&compressedCounter{d.body, &d.compressed})
+		if d.err != nil {
+			return 0, d.err
+		}
+	}
+
+	n, err := d.reader.Read(p)
+	d.decompressed += int64(n)
+	if d.exceeded() {
+		d.err = &DecompressionError{
+			Compressed:   d.compressed,
+			Decompressed: d.decompressed,
+			MaxSize:      d.limits.maxSize,
+			MaxRatio:     d.limits.maxRatio,
+		}
+		return n, d.err
+	}
+	return n, err
+}
+
+func (d *boundedDecompressor) exceeded() bool {
+	if d.limits.maxSize > 0 && d.decompressed > d.limits.maxSize {
+		return true
+	}
+	return d.limits.maxRatio > 0 && d.decompressed > ratioThreshold && d.compressed > 0 &&
+		float64(d.decompressed)/float64(d.compressed) > d.limits.maxRatio
+}
+
+func (d *boundedDecompressor) Close() error {
+	if d.reader != nil {
+		d.reader.Close()
+	}
+	return d.body.Close()
+}
+
+// compressedCounter counts the compressed bytes read from a body
+type compressedCounter struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *compressedCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,188 @@
+package quest
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// dialer is the dialer used by a Client's transport
+type dialer struct {
+	net.Dialer
+	failover     bool
+	reResolve    bool
+	perIPTimeout time.Duration
+	resolver     *net.Resolver
+	prefer       string
+	custom       func(ctx context.Context, network, address string) (net.Conn, error)
+
+	retryDNS            bool
+	bypassNegativeCache bool
+}
+
+func newDialer() *dialer {
+	// these match the dialer used by http.DefaultTransport
+	return &dialer{
+		Dialer: net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		resolver: net.DefaultResolver,
+	}
+}
+
+// DialFailover makes the client try every address a host resolves to, one at a
+// time, before giving up on a connection. Each address gets perIPTimeout to connect
+// (zero means no per address limit). If reResolve is true the host is resolved and
+// tried once more after all of its addresses failed.
+func (c *Client) DialFailover(perIPTimeout time.Duration, reResolve bool) *Client {
+	d := c.dialer()
+	d.failover = true
+	d.perIPTimeout = perIPTimeout
+	d.reResolve = reResolve
+	return c
+}
+
+// FallbackDelay sets how long to wait for the preferred address family before
+// racing a connection over the other one ("Happy Eyeballs"). A negative value
+// disables the fallback.
+func (c *Client) FallbackDelay(d time.Duration) *Client {
+	c.dialer().FallbackDelay = d
+	return c
+}
+
+// KeepAlive sets the keep-alive period for the client's connections. A negative
+// value disables keep-alives.
+func (c *Client) KeepAlive(d time.Duration) *Client {
+	c.dialer().KeepAlive = d
+	return c
+}
+
+// PreferIPv4 makes the client connect over IPv4 first and only fall back to IPv6
+// when that fails, for networks with broken IPv6
+func (c *Client) PreferIPv4() *Client {
+	c.dialer().prefer = "tcp4"
+	return c
+}
+
+// PreferIPv6 makes the client connect over IPv6 first and only fall back to IPv4
+// when that fails
+func (c *Client) PreferIPv6() *Client {
+	c.dialer().prefer = "tcp6"
+	return c
+}
+
+// DialContext sets a custom function used to open connections. The client's
+// failover and address family preferences are applied on top of it.
+func (c *Client) DialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) *Client {
+	c.dialer().custom = dial
+	return c
+}
+
+// dialer returns the client's dialer so an option can change it, installing it on
+// the client's transport. Copies of the transport made for bound requests are
+// discarded so their connections are dialed with the new options.
+func (c *Client) dialer() *dialer {
+	if c.dial == nil {
+		c.dial = newDialer()
+		c.httpTransport().DialContext = c.dial.DialContext
+	}
+	c.derived.reset()
+	return c.dial
+}
+
+// DialContext connects to address, looking its host up again after a failed lookup
+// when RetryDNS is set
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.dialPreferred(ctx, network, address)
+	if err != nil && d.retryDNS && ctx.Err() == nil && d.retryableDNS(err) {
+		return d.redialDNS(ctx, network, address)
+	}
+	return conn, err
+}
+
+// dialPreferred connects to address using the preferred address family first
+func (d *dialer) dialPreferred(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.prefer == "" || network != "tcp" {
+		return d.dialHost(ctx, network, address)
+	}
+	conn, err := d.dialHost(ctx, d.prefer, address)
+	if err == nil || ctx.Err() != nil {
+		return conn, err
+	}
+	fallback := "tcp6"
+	if d.prefer == "tcp6" {
+		fallback = "tcp4"
+	}
+	return d.dialHost(ctx, fallback, address)
+}
+
+// dialHost connects to address, failing over between resolved addresses when enabled
+func (d *dialer) dialHost(ctx context.Context, network, address string) (net.Conn, error) {
+	if !d.failover {
+		return d.dial(ctx, network, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dial(ctx, network, address)
+	}
+
+	attempts := 1
+	if d.reResolve {
+		attempts = 2
+	}
+
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		addrs, err := d.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, addr := range addrs {
+			if !networkMatches(network, addr.IP) {
+				continue
+			}
+			conn, err := d.dialOne(ctx, network, net.JoinHostPort(addr.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				return nil, lastErr
+			}
+		}
+	}
+	if lastErr == nil {
+		lastErr = &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	return nil, lastErr
+}
+
+func (d *dialer) dialOne(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.perIPTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.perIPTimeout)
+		defer cancel()
+	}
+	return d.dial(ctx, network, address)
+}
+
+func (d *dialer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.custom != nil {
+		return d.custom(ctx, network, address)
+	}
+	return d.Dialer.DialContext(ctx, network, address)
+}
+
+// networkMatches reports whether ip can be dialed on network ("tcp", "tcp4" or "tcp6")
+func networkMatches(network string, ip net.IP) bool {
+	switch network {
+	case "tcp4", "udp4":
+		return ip.To4() != nil
+	case "tcp6", "udp6":
+		return ip.To4() == nil
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package quest
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Kinds of failed host lookups, as reported by MetricDNSErrors
+const (
+	dnsNotFound  = "not_found"
+	dnsTimeout   = "timeout"
+	dnsTemporary = "temporary"
+)
+
+// Resolver sets the resolver the client looks up hosts with, e.g. one that queries
+// specific DNS servers
+func (c *Client) Resolver(resolver *net.Resolver) *Client {
+	d := c.dialer()
+	d.resolver = resolver
+	d.Dialer.Resolver = resolver
+	return c
+}
+
+// RetryDNS makes the client look a host up once more when resolving it fails with
+// a temporary error or a timeout. If bypassNegativeCache is true a host that was
+// not found is looked up again too, with the client's Resolver or else Go's own
+// resolver, which asks the DNS servers directly instead of returning a negative
+// answer the operating system cached during a blip.
+func (c *Client) RetryDNS(bypassNegativeCache bool) *Client {
+	d := c.dialer()
+	d.retryDNS = true
+	d.bypassNegativeCache = bypassNegativeCache
+	return c
+}
+
+// dnsErrorKind classifies err if it is a failed host lookup, or returns ""
+func dnsErrorKind(err error) string {
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		return ""
+	}
+	switch {
+	case dnsErr.IsNotFound:
+		return dnsNotFound
+	case dnsErr.IsTimeout:
+		return dnsTimeout
+	}
+	return dnsTemporary
+}
+
+// redialDNS resolves the host of address again and connects to the first of its
+// addresses that accepts the connection
+func (d *dialer) redialDNS(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	resolver := d.resolver
+	if d.bypassNegativeCache && resolver == net.DefaultResolver {
+		resolver = &net.Resolver{PreferGo: true}
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	lastErr := error(&net.AddrError{Err: "no suitable address found", Addr: host})
+	for _, addr := range addrs {
+		if !networkMatches(network, addr.IP) {
+			continue
+		}
+		conn, err := d.dialOne(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// retryableDNS reports whether a dial that failed with err should look the host
+// up again
+func (d *dialer) retryableDNS(err error) bool {
+	switch dnsErrorKind(err) {
+	case dnsTimeout, dnsTemporary:
+		return true
+	case dnsNotFound:
+		return d.bypassNegativeCache
+	}
+	return false
+}
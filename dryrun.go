@@ -0,0 +1,54 @@
+package quest
+
+import (
+	"io/ioutil"
+	"net/http"
+)
+
+// RequestSnapshot is the request that would be sent, as returned by DryRun
+type RequestSnapshot struct {
+	Method        string
+	URL           string
+	Header        http.Header
+	Body          []byte
+	ContentLength int64
+}
+
+// DryRun resolves the request exactly as Send would (url, headers, auth, signing and
+// body) and returns it without sending it, so tests can assert on the wire-level
+// request a code path produces
+func (r *Request) DryRun() (*RequestSnapshot, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	req, err := r.prepare()
+	if err != nil {
+		return nil, handleRequestError(err, r)
+	}
+	if limits := r.decompressLimits(); limits.enabled() && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+	if req.Close {
+		req.Header.Set("Connection", "close")
+	}
+	if signer := r.getSigner(); signer != nil {
+		if err := signer(req, r.clock().Now().Add(r.skew().get(req.URL.Host))); err != nil {
+			closeBody(req)
+			return nil, handleRequestError(err, r)
+		}
+	}
+
+	snapshot := &RequestSnapshot{
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		Header:        req.Header,
+		ContentLength: req.ContentLength,
+	}
+	if req.Body != nil {
+		defer req.Body.Close()
+		if snapshot.Body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, handleRequestError(err, r)
+		}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,62 @@
+package quest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ContentEncodings returns the codings listed in the response's Content-Encoding
+// header, in the order they were applied. When net/http transparently decompressed
+// a gzip response (and removed the header) "gzip" is returned.
+func (r *Response) ContentEncodings() []string {
+	if r.Response == nil {
+		return nil
+	}
+	encodings := parseCodings(r.Response.Header["Content-Encoding"])
+	if len(encodings) == 0 && r.Response.Uncompressed {
+		encodings = []string{"gzip"}
+	}
+	return encodings
+}
+
+// TransferEncodings returns the transfer codings of the response, e.g. "chunked"
+func (r *Response) TransferEncodings() []string {
+	if r.Response == nil {
+		return nil
+	}
+	return parseCodings(r.Response.TransferEncoding)
+}
+
+// ExpectEncoding will error if the response body was not encoded with the given
+// content coding (e.g. "gzip" or "br"). "identity" expects no content coding.
+func (r *Response) ExpectEncoding(value string) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	value = strings.ToLower(value)
+	actual := r.ContentEncodings()
+	if value == "identity" && len(actual) == 0 {
+		return r
+	}
+	for _, encoding := range actual {
+		if encoding == value {
+			return r
+		}
+	}
+	err := fmt.Errorf("Invalid Encoding. Expected %q, got %q", value, strings.Join(actual, ", "))
+	r.req.err = handleResponseError(err, r.req, r)
+	return r
+}
+
+// parseCodings splits comma separated header values into lower case codings
+func parseCodings(values []string) []string {
+	var codings []string
+	for _, value := range values {
+		for _, coding := range strings.Split(value, ",") {
+			if coding = strings.ToLower(strings.TrimSpace(coding)); coding != "" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	return codings
+}
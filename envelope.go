@@ -0,0 +1,134 @@
+package quest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// EnvelopeError is the error embedded in an enveloped response, e.g.
+// {"code": 1002, "message": "not found", "data": null}
+type EnvelopeError struct {
+	Code    string
+	Message string
+}
+
+func (e *EnvelopeError) Error() string {
+	return fmt.Sprintf("envelope error code %s: %s", e.Code, e.Message)
+}
+
+// GetJSONEnvelope decodes the value at dataPath into into for APIs that wrap every
+// response in an envelope. Paths are dot separated keys, e.g. "result.data".
+//
+// errorPath points at either the embedded code (e.g. "code") or an error object
+// with "code" and "message" keys (e.g. "error"). A missing or null value, a code of
+// zero, a 2xx code or "ok" means success; anything else fails with an
+// *EnvelopeError carrying the embedded message.
+func (r *Response) GetJSONEnvelope(dataPath, errorPath string, into interface{}) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	b, err := r.readBody()
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	api := r.req.json()
+	root := api.Get(b)
+	if err := root.LastError(); err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+
+	if errorPath != "" {
+		if err := envelopeError(root, errorPath); err != nil {
+			r.req.err = handleResponseError(err, r.req, r)
+			return r
+		}
+	}
+
+	data := lookupPath(root, dataPath)
+	if data.ValueType() == jsoniter.InvalidValue {
+		err := fmt.Errorf("Invalid Envelope. Expected %q in body, got none", dataPath)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	raw, err := api.Marshal(data)
+	if err == nil {
+		err = api.Unmarshal(raw, into)
+	}
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+	}
+	return r
+}
+
+// envelopeError returns the error at path, if any
+func envelopeError(root jsoniter.Any, path string) *EnvelopeError {
+	value := lookupPath(root, path)
+	var code, message jsoniter.Any
+	switch value.ValueType() {
+	case jsoniter.InvalidValue, jsoniter.NilValue:
+		return nil
+	case jsoniter.ObjectValue:
+		if value.Size() == 0 {
+			return nil
+		}
+		code, message = value.Get("code"), value.Get("message")
+	default:
+		code = value
+		// the message sits next to the code
+		parent := ""
+		if i := strings.LastIndex(path, "."); i >= 0 {
+			parent = path[:i]
+		}
+		message = lookupPath(root, parent).Get("message")
+	}
+
+	if code.ValueType() != jsoniter.InvalidValue && envelopeSuccess(code) {
+		return nil
+	}
+	e := &EnvelopeError{Code: code.ToString()}
+	if message.ValueType() == jsoniter.StringValue {
+		e.Message = message.ToString()
+	}
+	return e
+}
+
+// envelopeSuccess reports whether an embedded code means success
+func envelopeSuccess(code jsoniter.Any) bool {
+	switch code.ValueType() {
+	case jsoniter.NumberValue:
+		n := code.ToInt()
+		return n == 0 || (n >= 200 && n < 300)
+	case jsoniter.BoolValue:
+		return !code.ToBool()
+	case jsoniter.StringValue:
+		s := strings.ToLower(code.ToString())
+		return s == "" || s == "0" || s == "ok" || s == "success"
+	}
+	return false
+}
+
+// lookupPath returns the value at a dot separated path in root. Numeric keys
+// index into arrays.
+func lookupPath(root jsoniter.Any, path string) jsoniter.Any {
+	value := root
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			continue
+		}
+		if value.ValueType() == jsoniter.ArrayValue {
+			i, err := strconv.Atoi(key)
+			if err != nil {
+				return value.Get(key) // an invalid value
+			}
+			value = value.Get(i)
+			continue
+		}
+		value = value.Get(key)
+	}
+	return value
+}
@@ -0,0 +1,61 @@
+package quest
+
+import "fmt"
+
+// ErrorResponse is wrapped by the error of ExpectSuccessOr when the response has
+// an unexpected status code. It matches ErrStatus with errors.Is and, if Body
+// implements error, unwraps to it so errors.As can find the decoded payload.
+type ErrorResponse struct {
+	StatusCode int
+	// Body is the errTarget given to ExpectSuccessOr with the response body decoded
+	// into it, or nil if the body could not be decoded
+	Body interface{}
+	// Raw is the undecoded response body
+	Raw []byte
+}
+
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("Invalid StatusCode. Expected to be in 200 range, got '%d': %q", e.StatusCode, bodySnippet(e.Raw))
+}
+
+// Is reports whether target is ErrStatus
+func (e *ErrorResponse) Is(target error) bool {
+	return target == ErrStatus
+}
+
+// Unwrap returns Body if it is an error
+func (e *ErrorResponse) Unwrap() error {
+	if err, ok := e.Body.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// ExpectSuccessOr will error if StatusCode is not in 200 range, like
+// ExpectSuccess, and decode the JSON error payload of the response into errTarget
+// (a pointer). The error wraps an *ErrorResponse holding errTarget:
+//
+//	var apiErr APIError
+//	err := quest.Get(url).Send().ExpectSuccessOr(&apiErr).GetJSON(&user).Done()
+//	var errResp *quest.ErrorResponse
+//	if errors.As(err, &errResp) { ... apiErr.Code ... }
+func (r *Response) ExpectSuccessOr(errTarget interface{}) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	if actual := r.Response.StatusCode; actual >= 200 && actual < 300 {
+		return r
+	}
+
+	b, err := r.readBody()
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	errResp := &ErrorResponse{StatusCode: r.Response.StatusCode, Raw: b}
+	if r.notJSON(b) == nil && r.req.json().Unmarshal(b, errTarget) == nil {
+		errResp.Body = errTarget
+	}
+	r.req.err = handleResponseError(errResp, r.req, r)
+	return r
+}
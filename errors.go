@@ -1,37 +1,130 @@
 package quest
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
-type requestError struct {
-	message string
+// ErrQueueTimeout is returned when a request waits longer than the client's
+// QueueTimeout for a free MaxConcurrent slot
+var ErrQueueTimeout = errors.New("timed out waiting for a free request slot")
+
+// ErrStatus is wrapped by the errors of ExpectSuccess, ExpectStatusCode and
+// ExpectRedirect when the response has an unexpected status code, so they can be
+// detected with errors.Is
+var ErrStatus = errors.New("unexpected status code")
+
+// RequestError is returned when a request could not be built or sent. Use
+// errors.As with a **RequestError to inspect it.
+type RequestError struct {
 	Request *Request
+	TraceID string
+	SpanID  string
+	err     error
 }
 
-type responseError struct {
-	message  string
+// ResponseError is returned when a response does not meet an expectation or could
+// not be read. Use errors.As with a **ResponseError to inspect it.
+type ResponseError struct {
 	Request  *Request
 	Response *Response
+	TraceID  string
+	SpanID   string
+	err      error
+}
+
+func (e RequestError) Error() string {
+	return fmt.Sprintf("[Quest]: Request Error - %s%s\n\nRequest Info:\n %s", e.err.Error(), traceSuffix(e.TraceID, e.SpanID), e.Request.format())
+}
+
+// Unwrap returns the underlying error, e.g. a *url.Error or a *PhaseTimeoutError
+func (e RequestError) Unwrap() error {
+	return e.err
+}
+
+// Method returns the request's http method
+func (e RequestError) Method() string {
+	return e.Request.method
+}
+
+// URL returns the request's url
+func (e RequestError) URL() string {
+	return e.Request.URL.String()
+}
+
+func (e ResponseError) Error() string {
+	return fmt.Sprintf("[Quest]: Request Error - %s%s\n\nRequest Info:\n %s\n\nResponse Info:\n %s", e.err.Error(), traceSuffix(e.TraceID, e.SpanID), e.Request.format(), e.Response.format())
+}
+
+// Unwrap returns the underlying error, e.g. one wrapping ErrStatus
+func (e ResponseError) Unwrap() error {
+	return e.err
 }
 
-func (e requestError) Error() string {
-	return fmt.Sprintf("[Quest]: Request Error - %s\n\nRequest Info:\n %s", e.message, e.Request.format())
+// StatusCode returns the response's status code
+func (e ResponseError) StatusCode() int {
+	if e.Response == nil || e.Response.Response == nil {
+		return 0
+	}
+	return e.Response.StatusCode
 }
 
-func (e responseError) Error() string {
-	return fmt.Sprintf("[Quest]: Request Error - %s\n\nRequest Info:\n %s\n\nResponse Info:\n %s", e.message, e.Request.format(), e.Response.format())
+// Method returns the request's http method
+func (e ResponseError) Method() string {
+	return e.Request.method
 }
 
-func handleRequestError(err error, req *Request) *requestError {
-	return &requestError{
-		message: err.Error(),
+// URL returns the request's url
+func (e ResponseError) URL() string {
+	return e.Request.URL.String()
+}
+
+func handleRequestError(err error, req *Request) *RequestError {
+	traceID, spanID := req.traceIDs()
+	return &RequestError{
 		Request: req,
+		TraceID: traceID,
+		SpanID:  spanID,
+		err:     err,
 	}
 }
 
-func handleResponseError(err error, req *Request, resp *Response) *responseError {
-	return &responseError{
-		message:  err.Error(),
+func handleResponseError(err error, req *Request, resp *Response) *ResponseError {
+	traceID, spanID := req.traceIDs()
+	return &ResponseError{
 		Request:  req,
 		Response: resp,
+		TraceID:  traceID,
+		SpanID:   spanID,
+		err:      err,
+	}
+}
+
+// statusError is returned when the response status code is not the expected one.
+// It unwraps to ErrStatus.
+type statusError struct {
+	message string
+}
+
+func newStatusError(format string, args ...interface{}) error {
+	return statusError{fmt.Sprintf(format, args...)}
+}
+
+func (e statusError) Error() string {
+	return e.message
+}
+
+func (e statusError) Unwrap() error {
+	return ErrStatus
+}
+
+// traceSuffix formats the trace and span ID for the first line of an error
+func traceSuffix(traceID, spanID string) string {
+	if traceID == "" {
+		return ""
+	}
+	if spanID == "" {
+		return fmt.Sprintf(" (trace_id=%s)", traceID)
 	}
+	return fmt.Sprintf(" (trace_id=%s span_id=%s)", traceID, spanID)
 }
@@ -0,0 +1,130 @@
+package quest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Exchange is an immutable record of a request and its response, suitable for audit
+// logs or message queues
+type Exchange struct {
+	Method             string        `json:"method"`
+	URL                string        `json:"url"`
+	RequestHeader      http.Header   `json:"requestHeader"`
+	RequestBodySHA256  string        `json:"requestBodySha256,omitempty"`
+	StatusCode         int           `json:"statusCode,omitempty"`
+	ResponseHeader     http.Header   `json:"responseHeader,omitempty"`
+	ResponseBodySHA256 string        `json:"responseBodySha256,omitempty"`
+	Started            time.Time     `json:"started"`
+	Latency            time.Duration `json:"latency"`
+	Attempts           []Attempt     `json:"attempts"`
+	Error              string        `json:"error,omitempty"`
+}
+
+// Attempt is a single round trip made while sending a request. Redirects and
+// retries each add an attempt.
+type Attempt struct {
+	Method     string        `json:"method"`
+	URL        string        `json:"url"`
+	Started    time.Time     `json:"started"`
+	Duration   time.Duration `json:"duration"`
+	StatusCode int           `json:"statusCode,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Exchange returns a record of the request and response with sensitive headers
+// redacted and bodies reduced to their SHA-256 hashes. The response body is buffered
+// so it can still be read afterwards.
+func (r *Response) Exchange() *Exchange {
+	e := &Exchange{
+		Method:        r.req.method,
+		RequestHeader: redactHeader(r.sentHeader),
+		Started:       r.started,
+		Latency:       r.latency,
+		Attempts:      r.attempts.list(),
+	}
+	if r.req.URL != nil {
+		e.URL = r.req.URL.String()
+	}
+	if r.req.body != nil {
+		if body, err := r.req.GetBody(); err == nil {
+			e.RequestBodySHA256 = hashReader(body)
+			body.Close()
+		}
+	}
+	if r.Response != nil && r.Response.Body != nil && r.Response.StatusCode != 0 {
+		e.StatusCode = r.Response.StatusCode
+		e.ResponseHeader = redactHeader(r.Response.Header)
+		if b, err := r.readBody(); err == nil {
+			sum := sha256.Sum256(b)
+			e.ResponseBodySHA256 = hex.EncodeToString(sum[:])
+		}
+	}
+	if r.req.err != nil {
+		e.Error = r.req.err.Error()
+	}
+	return e
+}
+
+func hashReader(r io.Reader) string {
+	h := sha256.New()
+	io.Copy(h, r)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// attemptLog collects the attempts made by a request
+type attemptLog struct {
+	mu       sync.Mutex
+	attempts []Attempt
+}
+
+func (l *attemptLog) add(a Attempt) {
+	l.mu.Lock()
+	l.attempts = append(l.attempts, a)
+	l.mu.Unlock()
+}
+
+func (l *attemptLog) list() []Attempt {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Attempt(nil), l.attempts...)
+}
+
+// recordingTransport records every round trip made through it
+type recordingTransport struct {
+	base http.RoundTripper
+	log  *attemptLog
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	attempt := Attempt{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Started:  start,
+		Duration: time.Since(start),
+	}
+	if resp != nil {
+		attempt.StatusCode = resp.StatusCode
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	t.log.add(attempt)
+	return resp, err
+}
+
+// CloseIdleConnections lets http.Client close the base transport's idle connections
+func (t *recordingTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
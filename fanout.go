@@ -0,0 +1,165 @@
+package quest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Fan sends copies of a request to several hosts at once
+type Fan struct {
+	req     *Request
+	targets []string
+}
+
+// FanOut creates a Fan that sends a copy of req to each of the targets. A target is
+// either a host ("eu.example.com") or a scheme and host ("https://eu.example.com")
+// that replaces the one in the request's url.
+func FanOut(req *Request, targets []string) *Fan {
+	return &Fan{req: req, targets: targets}
+}
+
+// All sends the request to every target concurrently and returns all of the
+// responses in the same order as the targets
+func (f *Fan) All() []*Response {
+	responses := make([]*Response, len(f.targets))
+	var wg sync.WaitGroup
+	for i, target := range f.targets {
+		wg.Add(1)
+		go func(i int, req *Request) {
+			defer wg.Done()
+			responses[i] = req.Send()
+		}(i, f.request(target))
+	}
+	wg.Wait()
+	return responses
+}
+
+// FirstSuccess sends the request to every target concurrently and returns the first
+// response with a 2xx status code. The requests still in flight are cancelled.
+//
+// If no target succeeds the response for the first target is returned with an error.
+func (f *Fan) FirstSuccess() *Response {
+	if len(f.targets) == 0 {
+		req := f.req.clone()
+		req.err = handleRequestError(fmt.Errorf("no fan out targets"), req)
+		return req.Send()
+	}
+
+	type result struct {
+		index int
+		resp  *Response
+	}
+
+	parent := f.req.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	results := make(chan result, len(f.targets))
+	cancels := make([]context.CancelFunc, len(f.targets))
+	for i, target := range f.targets {
+		ctx, cancel := context.WithCancel(parent)
+		cancels[i] = cancel
+		go func(i int, req *Request) {
+			results <- result{i, req.Send()}
+		}(i, f.request(target).WithContext(ctx))
+	}
+
+	// return as soon as a target succeeds; the others are cancelled and their
+	// responses closed in the background
+	responses := make([]*Response, len(f.targets))
+	for received := 1; received <= len(f.targets); received++ {
+		res := <-results
+		if res.resp.Done() != nil || !isSuccess(res.resp.StatusCode) {
+			responses[res.index] = res.resp
+			continue
+		}
+		for i, cancel := range cancels {
+			if i != res.index {
+				cancel()
+			}
+		}
+		for _, resp := range responses {
+			abandon(resp)
+		}
+		go func(pending int) {
+			for ; pending > 0; pending-- {
+				abandon((<-results).resp)
+			}
+		}(len(f.targets) - received)
+		return keepResponse(res.resp, cancels[res.index])
+	}
+
+	for i, resp := range responses[1:] {
+		abandon(resp)
+		cancels[i+1]()
+	}
+	return keepResponse(responses[0], cancels[0]).ExpectSuccess()
+}
+
+// keepResponse returns resp with its request's context cancelled once its body is
+// closed
+func keepResponse(resp *Response, cancel context.CancelFunc) *Response {
+	if resp.Response != nil && resp.Response.Body != nil {
+		resp.Response.Body = &cancelOnClose{resp.Response.Body, cancel}
+	} else {
+		cancel()
+	}
+	return resp
+}
+
+// request returns a copy of the template request pointed at target
+func (f *Fan) request(target string) *Request {
+	req := f.req.clone()
+	if req.err != nil {
+		return req
+	}
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			req.err = handleRequestError(err, req)
+			return req
+		}
+		req.URL.Scheme = u.Scheme
+		req.URL.Host = u.Host
+	} else {
+		req.URL.Host = target
+	}
+	return req
+}
+
+func isSuccess(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// abandon closes the body of a response without reading it
+func abandon(resp *Response) {
+	if resp != nil && resp.Response != nil && resp.Response.Body != nil {
+		resp.Response.Body.Close()
+	}
+}
+
+// discard closes the body of a response that will never be read
+func discard(resp *Response) {
+	if resp != nil && resp.Response != nil && resp.Response.Body != nil {
+		io.Copy(ioutil.Discard, resp.Response.Body)
+		resp.Response.Body.Close()
+	}
+}
+
+// cancelOnClose cancels a request's context once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
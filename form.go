@@ -0,0 +1,43 @@
+package quest
+
+import (
+	"bytes"
+	"net/url"
+)
+
+// FormBody sets values as the application/x-www-form-urlencoded body of the
+// request, replacing any fields set before. Keys are encoded in sorted order, as
+// set with FormEncoding.
+func (r *Request) FormBody(values url.Values) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.form = nil
+	for _, key := range sortedKeys(values) {
+		if len(values[key]) == 1 {
+			r.form = append(r.form, formParam{key, values[key][0]})
+		} else {
+			r.form = append(r.form, formParam{key, values[key]})
+		}
+	}
+	return r.formBody()
+}
+
+// FormField adds a field to the application/x-www-form-urlencoded body of the
+// request, e.g. for an OAuth token request:
+//
+//	quest.Post(tokenURL).FormField("grant_type", "client_credentials").FormField("scope", "read")
+func (r *Request) FormField(key, value string) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.form = append(r.form, formParam{key, value})
+	return r.formBody()
+}
+
+// formBody encodes the form fields as the body of the request
+func (r *Request) formBody() *Request {
+	opts, _ := r.formOptions()
+	r.Header("Content-Type", "application/x-www-form-urlencoded")
+	return r.Body(bytes.NewBufferString(encodeForm(r.form, opts)))
+}
@@ -0,0 +1,196 @@
+package quest
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ArrayStyle selects how a key with several values is encoded
+type ArrayStyle int
+
+const (
+	// ArrayRepeat repeats the key, e.g. a=1&a=2
+	ArrayRepeat ArrayStyle = iota
+	// ArrayBrackets appends [] to the key, e.g. a[]=1&a[]=2 (Rails, PHP)
+	ArrayBrackets
+	// ArrayComma joins the values with commas, e.g. a=1,2 (OpenAPI with explode
+	// set to false)
+	ArrayComma
+)
+
+// NestedStyle selects how the keys of nested maps are encoded
+type NestedStyle int
+
+const (
+	// NestedBrackets encodes nested keys in brackets, e.g. user[name]=x (Rails, PHP)
+	NestedBrackets NestedStyle = iota
+	// NestedDots joins nested keys with dots, e.g. user.name=x
+	NestedDots
+)
+
+// FormOptions configures how query parameters and form bodies are encoded. The
+// zero value encodes like url.Values, with spaces as "+" and repeated keys.
+type FormOptions struct {
+	// SpaceAsPercent encodes spaces as %20 instead of +
+	SpaceAsPercent bool
+	// Arrays is how keys with several values are encoded
+	Arrays ArrayStyle
+	// Nested is how the keys of nested maps are encoded
+	Nested NestedStyle
+}
+
+// FormEncoding sets the options used to encode query parameters and form bodies
+// for this request. It must be set before QueryParam, FormBody or FormField to
+// apply to them.
+func (r *Request) FormEncoding(opts FormOptions) *Request {
+	r.formOpts = &opts
+	return r
+}
+
+// FormEncoding sets the form encoding options for every request from this client
+func (c *Client) FormEncoding(opts FormOptions) *Client {
+	c.formOpts = &opts
+	return c
+}
+
+// formOptions returns the request's form options, falling back to the client's.
+// ok is false if neither set any.
+func (r *Request) formOptions() (opts FormOptions, ok bool) {
+	if r.formOpts != nil {
+		return *r.formOpts, true
+	}
+	if r.client != nil && r.client.formOpts != nil {
+		return *r.client.formOpts, true
+	}
+	return FormOptions{}, false
+}
+
+// formParam is a key and a value to encode. The value is a string, a []string or
+// a map of nested values.
+type formParam struct {
+	key   string
+	value interface{}
+}
+
+// addQuery adds p to the query parameters encoded with opts. Parameters that were
+// part of the url before are kept as they are.
+func (r *Request) addQuery(p formParam, opts FormOptions) *Request {
+	base := strings.TrimSuffix(r.URL.RawQuery, r.encodedQuery)
+	base = strings.TrimSuffix(base, "&")
+	r.query = append(r.query, p)
+	r.encodedQuery = encodeForm(r.query, opts)
+	if base == "" {
+		r.URL.RawQuery = r.encodedQuery
+	} else {
+		r.URL.RawQuery = base + "&" + r.encodedQuery
+	}
+	return r
+}
+
+// encodeForm encodes params in order. The string values of a repeated key are
+// encoded as one array.
+func encodeForm(params []formParam, opts FormOptions) string {
+	var merged []formParam
+	seen := map[string]int{}
+	for _, p := range params {
+		values, isStrings := formStrings(p.value)
+		i, ok := seen[p.key]
+		if !isStrings || !ok {
+			if isStrings {
+				seen[p.key] = len(merged)
+			}
+			merged = append(merged, p)
+			continue
+		}
+		prev, _ := formStrings(merged[i].value)
+		merged[i].value = append(prev[:len(prev):len(prev)], values...)
+	}
+
+	var pairs []string
+	for _, p := range merged {
+		pairs = appendFormPairs(pairs, formEscape(p.key, opts), p.value, opts)
+	}
+	return strings.Join(pairs, "&")
+}
+
+// appendFormPairs appends the encoded pairs of value to pairs. key is already
+// escaped.
+func appendFormPairs(pairs []string, key string, value interface{}, opts FormOptions) []string {
+	switch v := value.(type) {
+	case string:
+		return append(pairs, key+"="+formEscape(v, opts))
+	case []string:
+		switch opts.Arrays {
+		case ArrayComma:
+			escaped := make([]string, len(v))
+			for i, s := range v {
+				escaped[i] = formEscape(s, opts)
+			}
+			return append(pairs, key+"="+strings.Join(escaped, ","))
+		case ArrayBrackets:
+			key += "[]"
+		}
+		for _, s := range v {
+			pairs = append(pairs, key+"="+formEscape(s, opts))
+		}
+		return pairs
+	case map[string]string:
+		for _, k := range sortedKeys(v) {
+			pairs = appendFormPairs(pairs, nestedKey(key, k, opts), v[k], opts)
+		}
+		return pairs
+	case map[string][]string:
+		for _, k := range sortedKeys(v) {
+			pairs = appendFormPairs(pairs, nestedKey(key, k, opts), v[k], opts)
+		}
+		return pairs
+	case url.Values:
+		return appendFormPairs(pairs, key, map[string][]string(v), opts)
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			pairs = appendFormPairs(pairs, nestedKey(key, k, opts), v[k], opts)
+		}
+		return pairs
+	default:
+		return append(pairs, key+"="+formEscape(fmt.Sprint(v), opts))
+	}
+}
+
+// formStrings returns value as a list of strings if it is a string or []string
+func formStrings(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, true
+	case []string:
+		return v, true
+	}
+	return nil, false
+}
+
+// nestedKey returns the escaped key of child within parent
+func nestedKey(parent, child string, opts FormOptions) string {
+	if opts.Nested == NestedDots {
+		return parent + "." + formEscape(child, opts)
+	}
+	return parent + "[" + formEscape(child, opts) + "]"
+}
+
+func formEscape(s string, opts FormOptions) string {
+	escaped := url.QueryEscape(s)
+	if opts.SpaceAsPercent {
+		// QueryEscape encodes a literal + as %2B, so every + is a space
+		escaped = strings.ReplaceAll(escaped, "+", "%20")
+	}
+	return escaped
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,15 @@
+package quest
+
+// JSON decodes the response body into a new T and returns it, or the zero value and
+// the first error of the request's life-cycle, so no variable has to be declared up
+// front:
+//
+//	users, err := quest.JSON[[]User](quest.Get(url).Send().ExpectSuccess())
+func JSON[T any](r *Response) (T, error) {
+	var value T
+	if err := r.GetJSON(&value).Done(); err != nil {
+		var zero T
+		return zero, err
+	}
+	return value, nil
+}
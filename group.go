@@ -0,0 +1,71 @@
+package quest
+
+import (
+	"context"
+	"sync"
+)
+
+// SendGroup sends requests concurrently with a shared context, similar to
+// errgroup.Group. The first request to fail cancels the others.
+type SendGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	once sync.Once
+	err  error
+}
+
+// Group creates a SendGroup whose requests are sent with a context derived from ctx
+func Group(ctx context.Context) *SendGroup {
+	ctx, cancel := context.WithCancel(ctx)
+	return &SendGroup{ctx: ctx, cancel: cancel}
+}
+
+// Context returns the group's context. It is cancelled once a request fails or Wait
+// returns.
+func (g *SendGroup) Context() context.Context {
+	return g.ctx
+}
+
+// Go sends req in a new goroutine with the group's context. The response must have
+// a 2xx status code and, if out is not nil, its body is decoded into out with
+// GetJSON.
+func (g *SendGroup) Go(req *Request, out interface{}) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := g.Func(req, out)(); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+// Func returns a function that sends req like Go does, for use with an existing
+// errgroup:
+//
+//	eg.Go(group.Func(req, &out))
+func (g *SendGroup) Func(req *Request, out interface{}) func() error {
+	return func() error {
+		resp := req.WithContext(g.ctx).Send().ExpectSuccess()
+		if out != nil {
+			return resp.GetJSON(out).Done()
+		}
+		if err := resp.Done(); err != nil {
+			return err
+		}
+		discard(resp)
+		return nil
+	}
+}
+
+// Wait blocks until every request sent with Go has finished and returns the first
+// error, if any
+func (g *SendGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
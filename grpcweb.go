@@ -0,0 +1,40 @@
+package quest
+
+import (
+	"bytes"
+
+	"github.com/nicksrandall/quest/questgrpcweb"
+)
+
+// GRPCWebBody sets msg (a serialized protobuf message) as a framed grpc-web unary
+// request body. The request should be a POST to "/package.Service/Method".
+func (r *Request) GRPCWebBody(msg []byte) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.Header("Content-Type", questgrpcweb.ContentType)
+	r.Header("Accept", questgrpcweb.ContentType)
+	r.Header("X-Grpc-Web", "1")
+	return r.Body(questgrpcweb.Frame(msg))
+}
+
+// GetGRPCWeb unframes a grpc-web unary response and stores its serialized protobuf
+// message into into parameter. A non-zero grpc-status fails the chain with the
+// call's status code and message.
+func (r *Response) GetGRPCWeb(into *[]byte) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	b, err := r.readBody()
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	result, err := questgrpcweb.Unframe(r.Response.Header, bytes.NewReader(b))
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	*into = result.Message
+	return r
+}
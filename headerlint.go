@@ -0,0 +1,111 @@
+package quest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// overriddenHeaders are set by net/http from the request itself, so values set
+// through Header are ignored
+var overriddenHeaders = map[string]string{
+	"Host":              "use the url's host instead",
+	"Content-Length":    "it is computed from the body",
+	"Transfer-Encoding": "it is chosen by net/http",
+	"Trailer":           "it is chosen by net/http",
+}
+
+// HeaderWarning describes a header that was set in a way that will not behave as
+// the caller expects
+type HeaderWarning struct {
+	Key     string
+	Message string
+}
+
+func (w HeaderWarning) Error() string {
+	return fmt.Sprintf("header %q: %s", w.Key, w.Message)
+}
+
+// HeaderLint sets a hook that is called before the request is sent for every
+// header misconfiguration, such as setting the same header twice with different
+// casing or setting a header net/http overrides
+func (r *Request) HeaderLint(hook func(HeaderWarning)) *Request {
+	r.headerLint = hook
+	return r
+}
+
+// StrictHeaders makes header misconfigurations (see HeaderLint) fail the request
+func (r *Request) StrictHeaders() *Request {
+	r.strictHeaders = true
+	return r
+}
+
+// HeaderLint sets a header lint hook for every request from this client
+func (c *Client) HeaderLint(hook func(HeaderWarning)) *Client {
+	c.headerLint = hook
+	return c
+}
+
+// StrictHeaders makes header misconfigurations fail every request from this client
+func (c *Client) StrictHeaders() *Client {
+	c.strictHeaders = true
+	return c
+}
+
+// lintHeaders reports header misconfigurations to the lint hook and returns the
+// first one as an error in strict mode
+func (r *Request) lintHeaders() error {
+	hook := r.headerLint
+	strict := r.strictHeaders
+	if r.client != nil {
+		if hook == nil {
+			hook = r.client.headerLint
+		}
+		strict = strict || r.client.strictHeaders
+	}
+	if hook == nil && !strict {
+		return nil
+	}
+
+	keys := make([]string, 0, len(r.headers))
+	for key := range r.headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var warnings []HeaderWarning
+	seen := map[string]string{}
+	for _, key := range keys {
+		canonical := http.CanonicalHeaderKey(key)
+		if other, ok := seen[canonical]; ok {
+			warnings = append(warnings, HeaderWarning{
+				Key:     canonical,
+				Message: fmt.Sprintf("set as both %q and %q, only one value will be sent", other, key),
+			})
+		}
+		seen[canonical] = key
+		if reason, ok := overriddenHeaders[canonical]; ok {
+			warnings = append(warnings, HeaderWarning{
+				Key:     canonical,
+				Message: "ignored by net/http, " + reason,
+			})
+		}
+		if strings.TrimSpace(r.headers[key]) != r.headers[key] {
+			warnings = append(warnings, HeaderWarning{
+				Key:     canonical,
+				Message: "value has leading or trailing whitespace",
+			})
+		}
+	}
+
+	for _, w := range warnings {
+		if hook != nil {
+			hook(w)
+		}
+	}
+	if strict && len(warnings) > 0 {
+		return warnings[0]
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package quest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFormattedHeaderValue is how much of a header value is shown in errors and
+// debug output
+const maxFormattedHeaderValue = 512
+
+// LimitHeaderSize fails the request when the response headers are larger than n
+// bytes in total, protecting against upstreams that send huge headers. net/http
+// allows 1MB by default.
+func (r *Request) LimitHeaderSize(n int64) *Request {
+	r.maxHeaderBytes = n
+	return r
+}
+
+// LimitHeaderSize limits the response header size of every request from this
+// client, unless the request sets its own limit. See Request.LimitHeaderSize.
+func (c *Client) LimitHeaderSize(n int64) *Client {
+	c.headerLimit = n
+	return c
+}
+
+// limitedTransport returns a copy of base with the response header size limited
+// to limit bytes
+func (r *Request) limitedTransport(base *http.Transport, limit int64) *http.Transport {
+	key := derivedKey{base: base, maxHeaderBytes: limit}
+	return r.derivedTransports().get(key, func() *http.Transport {
+		t := cloneTransport(base)
+		t.MaxResponseHeaderBytes = limit
+		return t
+	})
+}
+
+// sanitizeHeader returns a copy of header that is safe to show in errors and logs:
+// control characters and invalid UTF-8 are escaped and long values are truncated
+func sanitizeHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+	clean := make(http.Header, len(header))
+	for key, values := range header {
+		cleanValues := make([]string, len(values))
+		for i, value := range values {
+			cleanValues[i] = sanitizeHeaderValue(value)
+		}
+		clean[sanitizeHeaderValue(key)] = cleanValues
+	}
+	return clean
+}
+
+func sanitizeHeaderValue(value string) string {
+	var truncated int
+	if len(value) > maxFormattedHeaderValue {
+		truncated = len(value) - maxFormattedHeaderValue
+		value = value[:maxFormattedHeaderValue]
+	}
+	clean := value
+	if strings.IndexFunc(value, unsafeHeaderRune) >= 0 || !utf8.ValidString(value) {
+		var b strings.Builder
+		for i, c := range value {
+			switch {
+			case c == utf8.RuneError && !strings.HasPrefix(value[i:], string(utf8.RuneError)):
+				fmt.Fprintf(&b, `\x%02x`, value[i])
+			case unsafeHeaderRune(c):
+				fmt.Fprintf(&b, `\u%04x`, c)
+			default:
+				b.WriteRune(c)
+			}
+		}
+		clean = b.String()
+	}
+	if truncated > 0 {
+		clean += fmt.Sprintf("... (%d more bytes)", truncated)
+	}
+	return clean
+}
+
+func unsafeHeaderRune(c rune) bool {
+	return c != '\t' && unicode.IsControl(c)
+}
@@ -0,0 +1,90 @@
+package quest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// HeaderMatcher matches a single header value in ExpectHeaderValues
+type HeaderMatcher struct {
+	desc  string
+	match func(value string) bool
+}
+
+func (m HeaderMatcher) String() string {
+	return m.desc
+}
+
+// HeaderEquals matches a header value equal to value
+func HeaderEquals(value string) HeaderMatcher {
+	return HeaderMatcher{fmt.Sprintf("equal to %q", value), func(v string) bool { return v == value }}
+}
+
+// HeaderContains matches a header value containing substr
+func HeaderContains(substr string) HeaderMatcher {
+	return HeaderMatcher{fmt.Sprintf("containing %q", substr), func(v string) bool { return strings.Contains(v, substr) }}
+}
+
+// HeaderPrefix matches a header value starting with prefix
+func HeaderPrefix(prefix string) HeaderMatcher {
+	return HeaderMatcher{fmt.Sprintf("starting with %q", prefix), func(v string) bool { return strings.HasPrefix(v, prefix) }}
+}
+
+// HeaderMatches matches a header value matching re
+func HeaderMatches(re *regexp.Regexp) HeaderMatcher {
+	return HeaderMatcher{fmt.Sprintf("matching %q", re), re.MatchString}
+}
+
+// ExpectHeaderCount will error if the header with given key does not have exactly
+// n values, counting repeated headers separately
+func (r *Response) ExpectHeaderCount(key string, n int) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	if actual := len(r.Response.Header.Values(key)); actual != n {
+		err := fmt.Errorf("Invalid Header. Expected %q header to have %d values, got %d", key, n, actual)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	return r
+}
+
+// ExpectHeaderValues will error unless every matcher matches a different value of
+// the header with given key, in any order. Unlike ExpectHeader it looks at every
+// value of a repeated header such as Set-Cookie.
+func (r *Response) ExpectHeaderValues(key string, matchers ...HeaderMatcher) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	values := r.Response.Header.Values(key)
+	owner := make([]int, len(values))
+	for i := range owner {
+		owner[i] = -1
+	}
+	for i, m := range matchers {
+		if !assignValue(matchers, values, owner, i, make([]bool, len(values))) {
+			err := fmt.Errorf("Invalid Header. Expected a %q header value %s, got %q", key, m, values)
+			r.req.err = handleResponseError(err, r.req, r)
+			return r
+		}
+	}
+	return r
+}
+
+// assignValue finds a value for matchers[i] that no other matcher owns, moving the
+// values of earlier matchers to other values they match when needed (an augmenting
+// path). owner holds the index of the matcher that owns each value, or -1.
+func assignValue(matchers []HeaderMatcher, values []string, owner []int, i int, seen []bool) bool {
+	for j, value := range values {
+		if seen[j] || !matchers[i].match(value) {
+			continue
+		}
+		seen[j] = true
+		if owner[j] < 0 || assignValue(matchers, values, owner, owner[j], seen) {
+			owner[j] = i
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package quest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// HealthOptions configures a HealthChecker. Zero values use the defaults.
+type HealthOptions struct {
+	// Interval between checks when the checker is started, 10s by default
+	Interval time.Duration
+	// Timeout of a single check, 2s by default
+	Timeout time.Duration
+	// SuccessThreshold and FailureThreshold are how many checks in a row must
+	// succeed or fail before the status changes, 1 by default
+	SuccessThreshold int
+	FailureThreshold int
+	// JSONField is a dot separated path in the response body (e.g. "status") that
+	// must equal JSONValue for the check to succeed
+	JSONField string
+	JSONValue string
+	// Client sends the checks, so they share its transport, headers and limits
+	Client *Client
+	// OnChange is called whenever the status changes from healthy to unhealthy or
+	// back
+	OnChange func(HealthStatus)
+}
+
+// HealthStatus is the result of a HealthChecker's checks
+type HealthStatus struct {
+	Healthy bool
+	// Err is the error of the last check, nil if it succeeded
+	Err     error
+	Checked time.Time
+}
+
+// HealthChecker checks an upstream dependency's health endpoint, e.g. to wire it
+// into a readiness probe. It is unhealthy until it has succeeded SuccessThreshold
+// times.
+type HealthChecker struct {
+	url  string
+	opts HealthOptions
+
+	mu        sync.Mutex
+	status    HealthStatus
+	successes int
+	failures  int
+}
+
+// HealthCheck creates a HealthChecker for url. A check succeeds when the response
+// has a 2xx status code and, if set, JSONField equals JSONValue.
+func HealthCheck(url string, opts HealthOptions) *HealthChecker {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	if opts.SuccessThreshold <= 0 {
+		opts.SuccessThreshold = 1
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 1
+	}
+	return &HealthChecker{url: url, opts: opts}
+}
+
+// Check runs a single check, updates the status and returns the check's error
+func (h *HealthChecker) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, h.opts.Timeout)
+	defer cancel()
+
+	req := Get(h.url)
+	if h.opts.Client != nil {
+		req = h.opts.Client.Get(h.url)
+	}
+	resp := req.WithContext(ctx).Send().ExpectSuccess()
+	if h.opts.JSONField != "" {
+		resp = resp.expectJSONField(h.opts.JSONField, h.opts.JSONValue)
+	}
+	if resp.Response != nil && resp.Response.Body != nil {
+		resp.Response.Body.Close()
+	}
+	err := resp.Done()
+	h.record(err, req.clock().Now())
+	return err
+}
+
+// record updates the status with the result of a check
+func (h *HealthChecker) record(err error, now time.Time) {
+	h.mu.Lock()
+	if err == nil {
+		h.successes, h.failures = h.successes+1, 0
+	} else {
+		h.successes, h.failures = 0, h.failures+1
+	}
+	healthy := h.status.Healthy
+	if !healthy && h.successes >= h.opts.SuccessThreshold {
+		healthy = true
+	} else if healthy && h.failures >= h.opts.FailureThreshold {
+		healthy = false
+	}
+	changed := healthy != h.status.Healthy
+	h.status = HealthStatus{Healthy: healthy, Err: err, Checked: now}
+	status := h.status
+	h.mu.Unlock()
+
+	if changed && h.opts.OnChange != nil {
+		h.opts.OnChange(status)
+	}
+}
+
+// Start checks every Interval until ctx is done. It blocks, so it is usually run
+// in its own goroutine.
+func (h *HealthChecker) Start(ctx context.Context) {
+	var clock Clock = systemClock{}
+	if h.opts.Client != nil {
+		clock = h.opts.Client.getClock()
+	}
+	for {
+		h.Check(ctx)
+		if err := sleep(ctx, clock, h.opts.Interval); err != nil {
+			return
+		}
+	}
+}
+
+// Status returns the current status
+func (h *HealthChecker) Status() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// Healthy reports whether the upstream is healthy
+func (h *HealthChecker) Healthy() bool {
+	return h.Status().Healthy
+}
+
+// ServeHTTP responds with 200 when healthy and 503 otherwise, so the checker can
+// be used as a readiness probe handler
+func (h *HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := h.Status()
+	if !status.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "unhealthy")
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// expectJSONField will error if the value at path in the JSON body is not value
+func (r *Response) expectJSONField(path, value string) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	b, err := r.readBody()
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	field := lookupPath(jsoniter.Get(b), path)
+	if actual := field.ToString(); field.ValueType() == jsoniter.InvalidValue || actual != value {
+		err := fmt.Errorf("Invalid Body. Expected %q to be %q, got %q", path, value, actual)
+		r.req.err = handleResponseError(err, r.req, r)
+	}
+	return r
+}
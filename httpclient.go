@@ -0,0 +1,69 @@
+package quest
+
+import (
+	"net/http"
+	"sync"
+)
+
+var defaultClient struct {
+	sync.RWMutex
+	client *http.Client
+}
+
+// SetDefaultClient sets the *http.Client requests are sent with unless they have
+// one of their own (see WithClient). Passing nil restores the default, which sends
+// requests with http.DefaultTransport.
+func SetDefaultClient(client *http.Client) {
+	defaultClient.Lock()
+	defaultClient.client = client
+	defaultClient.Unlock()
+}
+
+// WithClient sends the request with client so it shares client's connection pool,
+// cookie jar and timeout. The client is not modified; redirects are checked by
+// the request's redirect policy before client's CheckRedirect.
+func (r *Request) WithClient(client *http.Client) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.httpClient = client
+	return r
+}
+
+// newHTTPClient returns the *http.Client the request is sent with, recording every
+// attempt in attempts
+func (r *Request) newHTTPClient(attempts *attemptLog) *http.Client {
+	base := r.httpClient
+	if base == nil {
+		defaultClient.RLock()
+		base = defaultClient.client
+		defaultClient.RUnlock()
+	}
+
+	client := &http.Client{}
+	if base != nil {
+		*client = *base
+	}
+
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := r.checkRedirect(req, via); err != nil || checkRedirect == nil {
+			return err
+		}
+		return checkRedirect(req, via)
+	}
+
+	var transport http.RoundTripper = http.DefaultTransport
+	if t := r.httpTransport(); t != nil {
+		transport = t
+	} else if r.client != nil && r.client.roundTripper != nil {
+		transport = r.client.roundTripper
+	} else if client.Transport != nil {
+		transport = client.Transport
+	}
+	if r.debug != nil {
+		transport = &dumpTransport{base: transport, w: r.debug}
+	}
+	client.Transport = &recordingTransport{base: transport, log: attempts}
+	return client
+}
@@ -0,0 +1,114 @@
+package quest
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// JSONOptions configures how JSON is encoded by JSONBody and BodyAs, and how
+// requests and responses are formatted in errors and debug output. The zero value
+// encodes compact JSON with HTML characters escaped, like encoding/json.
+type JSONOptions struct {
+	// Indent indents encoded JSON with the given string, e.g. "  ". Errors and debug
+	// output are always indented, with two spaces unless Indent is set.
+	Indent string
+	// DisableHTMLEscape keeps <, > and & as is instead of escaping them as \u003c
+	// etc., for upstreams that reject the escaped form
+	DisableHTMLEscape bool
+	// SortKeys encodes map keys in sorted order so the output is stable
+	SortKeys bool
+}
+
+// JSONEncoding sets the options used to encode JSON for this request. It must be
+// set before JSONBody to apply to the request body.
+func (r *Request) JSONEncoding(opts JSONOptions) *Request {
+	r.jsonOpts = &opts
+	return r
+}
+
+// JSONEncoding sets the JSON encoding options for every request from this client
+func (c *Client) JSONEncoding(opts JSONOptions) *Client {
+	c.jsonOpts = &opts
+	return c
+}
+
+func (r *Request) jsonOptions() JSONOptions {
+	if r.jsonOpts != nil {
+		return *r.jsonOpts
+	}
+	if r.client != nil && r.client.jsonOpts != nil {
+		return *r.client.jsonOpts
+	}
+	return JSONOptions{}
+}
+
+func (o JSONOptions) formatIndent() string {
+	if o.Indent != "" {
+		return o.Indent
+	}
+	return "  "
+}
+
+type jsonConfig struct {
+	naming            *NamingStrategy
+	disableHTMLEscape bool
+	sortKeys          bool
+}
+
+// jsonAPIs caches a frozen config per combination of naming strategy and options,
+// because freezing a config is expensive and each one keeps its own type cache
+var jsonAPIs sync.Map
+
+// json returns the JSON API for the request's naming strategy and options
+func (r *Request) json() jsoniter.API {
+	naming := r.naming
+	if naming == nil && r.client != nil {
+		naming = r.client.naming
+	}
+	return jsonAPI(naming, r.jsonOptions())
+}
+
+// jsonAPI returns the JSON API for a naming strategy (which may be nil) and options
+func jsonAPI(naming *NamingStrategy, opts JSONOptions) jsoniter.API {
+	key := jsonConfig{naming, opts.DisableHTMLEscape, opts.SortKeys}
+	if key == (jsonConfig{}) {
+		return jsoniter.ConfigDefault
+	}
+	if api, ok := jsonAPIs.Load(key); ok {
+		return api.(jsoniter.API)
+	}
+	api := jsoniter.Config{EscapeHTML: !opts.DisableHTMLEscape, SortMapKeys: opts.SortKeys}.Froze()
+	if naming != nil {
+		api.RegisterExtension(&namingExtension{rename: naming.rename})
+	}
+	actual, _ := jsonAPIs.LoadOrStore(key, api)
+	return actual.(jsoniter.API)
+}
+
+// marshalJSON encodes v with the request's JSON API, indented with indent if set
+func (r *Request) marshalJSON(v interface{}, indent string) ([]byte, error) {
+	return marshalIndent(r.json(), v, indent)
+}
+
+// formatJSON encodes v for errors and debug output. The naming strategy is not
+// applied so the output keeps the same field names for every request.
+func (r *Request) formatJSON(v interface{}) ([]byte, error) {
+	opts := r.jsonOptions()
+	return marshalIndent(jsonAPI(nil, opts), v, opts.formatIndent())
+}
+
+func marshalIndent(api jsoniter.API, v interface{}, indent string) ([]byte, error) {
+	b, err := api.Marshal(v)
+	if err != nil || indent == "" {
+		return b, err
+	}
+	// jsoniter only indents with spaces
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", indent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
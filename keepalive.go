@@ -0,0 +1,28 @@
+package quest
+
+import "net/http"
+
+// CloseConnection sends the request with "Connection: close" so the connection is
+// closed once the response has been read. An idle connection may still be reused
+// to send it.
+func (r *Request) CloseConnection() *Request {
+	r.closeConn = true
+	return r
+}
+
+// DisableKeepAlive sends the request on a new connection that is closed once the
+// response has been read, for upstreams that hang on reused connections
+func (r *Request) DisableKeepAlive() *Request {
+	r.noKeepAlive = true
+	return r
+}
+
+// oneShotTransport returns a copy of base with keep-alives disabled
+func (r *Request) oneShotTransport(base *http.Transport) *http.Transport {
+	key := derivedKey{base: base, noKeepAlive: true}
+	return r.derivedTransports().get(key, func() *http.Transport {
+		t := cloneTransport(base)
+		t.DisableKeepAlives = true
+		return t
+	})
+}
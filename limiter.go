@@ -0,0 +1,149 @@
+package quest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// agingSteps is how many times a queued request can be passed over by requests of
+// higher priority before its own priority is raised by one level
+const agingSteps = 4
+
+// Priority orders requests waiting for a Client's MaxConcurrent slots
+type Priority int
+
+// Request priorities. Requests of the same priority are sent in FIFO order.
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// Priority sets the request's priority in its client's MaxConcurrent queue. Higher
+// priority requests are sent first; a request that keeps being passed over has its
+// priority raised so it is not starved.
+func (r *Request) Priority(level Priority) *Request {
+	r.priority = level
+	return r
+}
+
+// limiter bounds the number of concurrent requests and queues the rest by priority
+type limiter struct {
+	mu       sync.Mutex
+	max      int
+	timeout  time.Duration
+	inFlight int
+	waiters  []*waiter
+	report   func(inFlight, queued int)
+}
+
+// waiter is a request queued for a slot
+type waiter struct {
+	ready    chan struct{}
+	priority Priority
+	passed   int
+}
+
+// effective returns the waiter's priority raised by how often it was passed over
+func (w *waiter) effective() int {
+	return int(w.priority) + w.passed/agingSteps
+}
+
+func (l *limiter) setMax(n int) {
+	l.mu.Lock()
+	l.max = n
+	l.mu.Unlock()
+}
+
+func (l *limiter) setTimeout(d time.Duration) {
+	l.mu.Lock()
+	l.timeout = d
+	l.mu.Unlock()
+}
+
+func (l *limiter) counts() (inFlight, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight, len(l.waiters)
+}
+
+// acquire blocks until a slot is available, the context is done or the queue
+// timeout elapses
+func (l *limiter) acquire(ctx context.Context, clock Clock, priority Priority) error {
+	l.mu.Lock()
+	if l.max <= 0 || (l.inFlight < l.max && len(l.waiters) == 0) {
+		l.inFlight++
+		l.reportAndUnlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, &waiter{ready: ready, priority: priority})
+	timeout := l.timeout
+	l.reportAndUnlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		var stop func()
+		expired, stop = after(clock, timeout)
+		defer stop()
+	}
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		return l.abandon(ready, ctx.Err())
+	case <-expired:
+		return l.abandon(ready, ErrQueueTimeout)
+	}
+}
+
+// abandon removes a waiter from the queue. If the waiter was handed a slot in the
+// meantime the slot is released again.
+func (l *limiter) abandon(ready chan struct{}, err error) error {
+	l.mu.Lock()
+	for i, w := range l.waiters {
+		if w.ready == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			l.reportAndUnlock()
+			return err
+		}
+	}
+	l.mu.Unlock()
+	l.release()
+	return err
+}
+
+// release frees a slot, handing it directly to the waiter with the highest
+// priority if there is one
+func (l *limiter) release() {
+	l.mu.Lock()
+	if len(l.waiters) > 0 {
+		next := 0
+		for i, w := range l.waiters {
+			if w.effective() > l.waiters[next].effective() {
+				next = i
+			}
+		}
+		for _, w := range l.waiters {
+			if w.effective() < l.waiters[next].effective() {
+				w.passed++
+			}
+		}
+		close(l.waiters[next].ready)
+		l.waiters = append(l.waiters[:next], l.waiters[next+1:]...)
+	} else {
+		l.inFlight--
+	}
+	l.reportAndUnlock()
+}
+
+// reportAndUnlock reports the counts before unlocking, so reports arrive in the
+// order the counts changed
+func (l *limiter) reportAndUnlock() {
+	if l.report != nil {
+		l.report(l.inFlight, len(l.waiters))
+	}
+	l.mu.Unlock()
+}
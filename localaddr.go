@@ -0,0 +1,84 @@
+package quest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// LocalAddr sets the local (source) ip address the request's connection is made from
+func (r *Request) LocalAddr(ip string) *Request {
+	if r.err != nil {
+		return r
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		r.err = handleRequestError(fmt.Errorf("invalid local address %q", ip), r)
+		return r
+	}
+	r.localAddr = parsed.String()
+	return r
+}
+
+// Interface makes the request's connection from the first address of the named
+// network interface (e.g. "eth1"), preferring IPv4
+func (r *Request) Interface(name string) *Request {
+	if r.err != nil {
+		return r
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		r.err = handleRequestError(err, r)
+		return r
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		r.err = handleRequestError(err, r)
+		return r
+	}
+	var ip net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip == nil || (ip.To4() == nil && ipNet.IP.To4() != nil) {
+			ip = ipNet.IP
+		}
+	}
+	if ip == nil {
+		r.err = handleRequestError(fmt.Errorf("interface %q has no ip address", name), r)
+		return r
+	}
+	r.localAddr = ip.String()
+	return r
+}
+
+// boundTransport returns a copy of base whose connections are made from the
+// request's local address. Copies are kept per local address so connections from
+// different source addresses are never shared.
+func (r *Request) boundTransport(base *http.Transport) *http.Transport {
+	key := derivedKey{base: base, localAddr: r.localAddr}
+	return r.derivedTransports().get(key, func() *http.Transport {
+		t := cloneTransport(base)
+		addr := &net.TCPAddr{IP: net.ParseIP(r.localAddr)}
+		if c := r.client; c != nil && c.dial != nil && base == c.transport {
+			// keep the client's dialer options as they are when dialing
+			t.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := *c.dial
+				d.Dialer.LocalAddr = addr
+				return d.DialContext(ctx, network, address)
+			}
+		} else {
+			d := &net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				LocalAddr: addr,
+			}
+			t.DialContext = d.DialContext
+		}
+		return t
+	})
+}
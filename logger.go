@@ -0,0 +1,32 @@
+package quest
+
+import (
+	"sync"
+	"time"
+)
+
+// requestLogger logs when requests start and finish. It is implemented for
+// log/slog in slog.go, which needs Go 1.21.
+type requestLogger interface {
+	start(r *Request)
+	finish(r *Request, resp *Response, err error, d time.Duration)
+}
+
+var defaultLogger struct {
+	sync.RWMutex
+	logger requestLogger
+}
+
+// logger returns the request's logger, falling back to its client's and the
+// package default
+func (r *Request) logger() requestLogger {
+	if r.log != nil {
+		return r.log
+	}
+	if r.client != nil && r.client.log != nil {
+		return r.client.log
+	}
+	defaultLogger.RLock()
+	defer defaultLogger.RUnlock()
+	return defaultLogger.logger
+}
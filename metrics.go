@@ -0,0 +1,135 @@
+package quest
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Names of the metrics emitted to a MetricsHook
+const (
+	// MetricInFlight is emitted by each Client for its own requests and recorded by
+	// EnableMetrics for all requests
+	MetricInFlight = "quest_requests_in_flight"
+	MetricQueued   = "quest_requests_queued"
+
+	// MetricThrottleRate is labeled with "host"
+	MetricThrottleRate = "quest_throttle_rate"
+
+	// MetricRequestBytes and MetricResponseBytes are labeled with "method", "host"
+	// and "status_class", and with "operation" when the request has an operation
+	// name
+	MetricRequestBytes  = "quest_request_bytes"
+	MetricResponseBytes = "quest_response_bytes"
+
+	// MetricCacheHits, MetricNegativeCacheHits and MetricCacheMisses count GET
+	// requests answered from (or missing) the client's cache and are labeled with
+	// "host". Cached 404 and 410 responses count as negative hits.
+	MetricCacheHits         = "quest_cache_hits"
+	MetricNegativeCacheHits = "quest_negative_cache_hits"
+	MetricCacheMisses       = "quest_cache_misses"
+
+	// MetricBreakerOpen is 1 when the circuit breaker for a host opens and 0 when
+	// it closes again. It is labeled with "host".
+	MetricBreakerOpen = "quest_breaker_open"
+
+	// MetricRequests counts sent requests and MetricRequestDuration is how long each
+	// took to get the response headers, in seconds. Both are labeled with "method",
+	// "host" and "status_class" ("2xx", "4xx", ..., "dns_error" or "error").
+	MetricRequests        = "quest_requests_total"
+	MetricRequestDuration = "quest_request_duration_seconds"
+
+	// MetricDNSErrors counts requests that failed because their host could not be
+	// resolved. It is labeled with "host" and "kind" ("not_found", "timeout" or
+	// "temporary").
+	MetricDNSErrors = "quest_dns_errors_total"
+)
+
+// Metric is a single measurement emitted by a Client
+type Metric struct {
+	Name   string
+	Value  float64
+	Labels map[string]string
+}
+
+// MetricsHook receives metrics emitted by a Client. It may be called concurrently.
+type MetricsHook func(m Metric)
+
+var globalMetrics struct {
+	sync.RWMutex
+	collectors *collectors
+}
+
+// EnableMetrics registers Prometheus metrics for every request, whether it was
+// created by a Client or not, with registerer: request counts, durations and body
+// sizes labeled with "method", "host" and "status_class", the number of requests in
+// flight and DNS errors. Pass nil to stop recording them. A Client's WithMetrics
+// hook receives its requests' metrics independently of these.
+func EnableMetrics(registerer prometheus.Registerer) error {
+	if registerer == nil {
+		globalMetrics.Lock()
+		globalMetrics.collectors = nil
+		globalMetrics.Unlock()
+		return nil
+	}
+	c := newCollectors()
+	if err := c.register(registerer); err != nil {
+		return err
+	}
+	globalMetrics.Lock()
+	globalMetrics.collectors = c
+	globalMetrics.Unlock()
+	return nil
+}
+
+func globalCollectors() *collectors {
+	globalMetrics.RLock()
+	defer globalMetrics.RUnlock()
+	return globalMetrics.collectors
+}
+
+// emit sends m to the request's client hook and records it in the metrics
+// registered by EnableMetrics
+func (r *Request) emit(m Metric) {
+	if r.client != nil {
+		r.client.emit(m)
+	}
+	if c := globalCollectors(); c != nil {
+		c.observe(m)
+	}
+}
+
+// trackInFlight counts the request as in flight in the metrics registered by
+// EnableMetrics until the returned func is called
+func (r *Request) trackInFlight() func() {
+	c := globalCollectors()
+	if c == nil {
+		return func() {}
+	}
+	c.inFlight.Inc()
+	return c.inFlight.Dec
+}
+
+// statusClass returns the "status_class" label of a request that got resp and err
+func statusClass(resp *http.Response, err error) string {
+	if dnsErrorKind(err) != "" {
+		return "dns_error"
+	}
+	if err != nil || resp == nil {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", resp.StatusCode/100)
+}
+
+// reportRequest emits the request count and duration
+func (r *Request) reportRequest(resp *http.Response, err error, latency time.Duration) {
+	if kind := dnsErrorKind(err); kind != "" {
+		r.emit(Metric{Name: MetricDNSErrors, Value: 1, Labels: map[string]string{"host": r.URL.Host, "kind": kind}})
+	}
+	labels := map[string]string{"method": r.method, "host": r.URL.Host, "status_class": statusClass(resp, err)}
+	r.emit(Metric{Name: MetricRequests, Value: 1, Labels: labels})
+	r.emit(Metric{Name: MetricRequestDuration, Value: latency.Seconds(), Labels: labels})
+}
@@ -0,0 +1,61 @@
+package quest
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Handler sends a request and returns its response
+type Handler func(r *Request) *Response
+
+// Middleware wraps a Handler to add behavior around sending a request, such as
+// injecting auth headers, logging or recording metrics. It can change the request
+// before calling next and inspect or replace the response it returns.
+type Middleware func(next Handler) Handler
+
+var middleware struct {
+	sync.RWMutex
+	list []Middleware
+}
+
+// Use adds middleware that every request passes through when it is sent. The
+// first middleware added is the outermost.
+func Use(mw ...Middleware) {
+	middleware.Lock()
+	middleware.list = append(middleware.list, mw...)
+	middleware.Unlock()
+}
+
+// Use adds middleware that this request passes through when it is sent, inside of
+// the package-level middleware
+func (r *Request) Use(mw ...Middleware) *Request {
+	r.middleware = append(r.middleware, mw...)
+	return r
+}
+
+// handler returns the request's send wrapped in every middleware
+func (r *Request) handler() Handler {
+	middleware.RLock()
+	chain := append(append([]Middleware(nil), middleware.list...), r.middleware...)
+	middleware.RUnlock()
+
+	h := Handler((*Request).send)
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	return h
+}
+
+// OnBeforeSend adds a hook that is called with the final *http.Request right before
+// it is sent (and signed), after every header has been applied
+func (r *Request) OnBeforeSend(hook func(*http.Request)) *Request {
+	r.beforeSend = append(r.beforeSend, hook)
+	return r
+}
+
+// OnAfterReceive adds a hook that is called with the response once it has been
+// received. It is not called when the request fails without a response.
+func (r *Request) OnAfterReceive(hook func(*Response)) *Request {
+	r.afterReceive = append(r.afterReceive, hook)
+	return r
+}
@@ -0,0 +1,126 @@
+package quest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// mirrorTimeout bounds how long a mirrored request may take unless the client has
+// a Timeout
+const mirrorTimeout = 30 * time.Second
+
+// maxMirrored is how many mirrored requests may be in flight at once. Samples
+// taken while that many are in flight are dropped.
+const maxMirrored = 64
+
+// mirror duplicates a sample of a client's requests to a shadow environment
+type mirror struct {
+	target   *url.URL
+	rate     float64
+	requests inFlight
+	slots    chan struct{}
+}
+
+// Mirror asynchronously sends a copy of sampleRate (0.0 to 1.0) of this client's
+// requests to the same path on targetBaseURL, e.g. to validate a new backend with
+// production traffic. Responses from the mirror are discarded and never affect the
+// original request. Headers scoped to the original host are not copied. At most
+// 64 mirrored requests are in flight at once; samples beyond that are dropped.
+// Requests with a JSONBodyReader body are not mirrored since their reader cannot
+// be read by two requests.
+func (c *Client) Mirror(targetBaseURL string, sampleRate float64) *Client {
+	u, err := url.Parse(targetBaseURL)
+	if err == nil && (u.Scheme == "" || u.Host == "") {
+		err = errors.New("expected an absolute url")
+	}
+	if err != nil {
+		c.configErr = fmt.Errorf("error parsing mirror url %q: %v", targetBaseURL, err)
+		return c
+	}
+	c.mirror = &mirror{target: u, rate: sampleRate, slots: make(chan struct{}, maxMirrored)}
+	return c
+}
+
+// send mirrors req when it is sampled
+func (m *mirror) send(r *Request, req *http.Request) {
+	if m.rate <= 0 || r.sharedBody || r.random() >= m.rate {
+		return
+	}
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		return
+	}
+	sent := false
+	defer func() {
+		if !sent {
+			<-m.slots
+		}
+	}()
+
+	var body io.ReadCloser
+	if r.body != nil {
+		var err error
+		if body, _, err = r.body(); err != nil {
+			return
+		}
+	}
+
+	u := *m.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + req.URL.Path
+	u.RawPath = ""
+	u.RawQuery = req.URL.RawQuery
+
+	timeout := r.client.phases.request
+	if timeout <= 0 {
+		timeout = mirrorTimeout
+	}
+	ctx, finish, err := m.requests.track(context.Background())
+	if err != nil {
+		if body != nil {
+			body.Close()
+		}
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	shadow, err := http.NewRequestWithContext(ctx, req.Method, u.String(), body)
+	if err != nil {
+		cancel()
+		finish()
+		if body != nil {
+			body.Close()
+		}
+		return
+	}
+	shadow.Header = req.Header.Clone()
+	r.client.stripScopedHeaders(shadow)
+	r.client.applyScopedHeaders(shadow)
+
+	// sent with the client's transport, without the request's options
+	var transport http.RoundTripper = http.DefaultTransport
+	if r.client.transport != nil {
+		transport = r.client.transport
+	} else if r.client.roundTripper != nil {
+		transport = r.client.roundTripper
+	}
+	client := &http.Client{Transport: transport}
+	sent = true
+	go func() {
+		defer func() { <-m.slots }()
+		defer finish()
+		defer cancel()
+		resp, err := client.Do(shadow)
+		if err != nil {
+			return
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
@@ -0,0 +1,17 @@
+package quest
+
+// MsgpackBody encodes value with the codec registered for application/msgpack and
+// sets it as the body of the request. Importing the questmsgpack package registers
+// a MessagePack codec:
+//
+//	import _ "github.com/nicksrandall/quest/questmsgpack"
+func (r *Request) MsgpackBody(value interface{}) *Request {
+	return r.BodyAs("application/msgpack", value)
+}
+
+// GetMsgpack decodes the response body into into with the codec registered for
+// application/msgpack (see MsgpackBody), regardless of the Content-Type the server
+// returned
+func (r *Response) GetMsgpack(into interface{}) *Response {
+	return r.decodeAs("application/msgpack", into)
+}
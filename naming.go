@@ -0,0 +1,93 @@
+package quest
+
+import (
+	"strings"
+	"unicode"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// NamingStrategy maps Go struct field names to JSON keys in JSONBody and GetJSON.
+// Fields with an explicit name in their json tag keep that name.
+type NamingStrategy struct {
+	rename func(string) string
+}
+
+var (
+	// SnakeCase maps field names to snake_case, e.g. UserID to user_id
+	SnakeCase = NewNamingStrategy(snakeCase)
+	// CamelCase maps field names to camelCase, e.g. UserID to userID
+	CamelCase = NewNamingStrategy(camelCase)
+)
+
+// NewNamingStrategy creates a naming strategy that maps field names with rename
+func NewNamingStrategy(rename func(string) string) *NamingStrategy {
+	return &NamingStrategy{rename: rename}
+}
+
+// JSONNaming sets the naming strategy used to encode and decode JSON for this
+// request. It must be set before JSONBody to apply to the request body.
+func (r *Request) JSONNaming(strategy *NamingStrategy) *Request {
+	r.naming = strategy
+	return r
+}
+
+// JSONNaming sets the naming strategy for every request from this client
+func (c *Client) JSONNaming(strategy *NamingStrategy) *Client {
+	c.naming = strategy
+	return c
+}
+
+type namingExtension struct {
+	jsoniter.DummyExtension
+	rename func(string) string
+}
+
+func (e *namingExtension) UpdateStructDescriptor(desc *jsoniter.StructDescriptor) {
+	for _, binding := range desc.Fields {
+		name := binding.Field.Name()
+		if !unicode.IsUpper(rune(name[0])) {
+			continue
+		}
+		if tag, ok := binding.Field.Tag().Lookup("json"); ok {
+			if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+				continue // hidden or explicitly named
+			}
+		}
+		binding.ToNames = []string{e.rename(name)}
+		binding.FromNames = []string{e.rename(name)}
+	}
+}
+
+// snakeCase converts a Go field name to snake_case, keeping acronyms together
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, c := range runes {
+		if unicode.IsUpper(c) && i > 0 {
+			prevLower := !unicode.IsUpper(runes[i-1]) && runes[i-1] != '_'
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (nextLower && unicode.IsUpper(runes[i-1])) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// camelCase converts a Go field name to camelCase by lowering its leading
+// capital or acronym
+func camelCase(name string) string {
+	runes := []rune(name)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
@@ -1,16 +1,58 @@
 package quest
 
-import "net/http"
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
 
 // Next is used to chain requests together
 type Next struct {
-	err error
+	err   error
+	steps []Step
+	ctx   context.Context
+}
+
+// Step describes a request that is part of a chain
+type Step struct {
+	Index      int
+	Name       string
+	Method     string
+	URL        string
+	StatusCode int
+}
+
+// ChainError is returned when a request that is part of a chain fails. It records
+// the failed step and every step that completed before it and can be extracted
+// with errors.As.
+type ChainError struct {
+	Step      Step
+	Completed []Step
+	Err       error
+}
+
+func (e *ChainError) Error() string {
+	names := make([]string, len(e.Completed))
+	for i, step := range e.Completed {
+		names[i] = step.Name
+	}
+	return fmt.Sprintf("[Quest]: Chain Error - step %d (%s) failed after completing [%s]: %v",
+		e.Step.Index, e.Step.Name, strings.Join(names, ", "), e.Err)
+}
+
+// Unwrap returns the error of the failed step
+func (e *ChainError) Unwrap() error {
+	return e.Err
 }
 
 // New creates a new request with given http method and path (uri) and is
 // used when chaining requests together
 func (n *Next) New(method, path string) *Request {
 	req := New(method, path)
+	req.steps = n.steps
+	req.ctx = n.ctx
 	if req.err == nil {
 		req.err = n.err
 	}
@@ -36,3 +78,99 @@ func (n *Next) Put(path string) *Request {
 func (n *Next) Delete(path string) *Request {
 	return n.New(http.MethodDelete, path)
 }
+
+// Parallel sends the requests made by steps concurrently and joins them before the
+// chain continues. Each step creates its request from the Next it is given, which
+// carries the chain's context, and must read what it needs from the response
+// (e.g. with GetJSON) before returning it.
+//
+// If a step fails the others are cancelled, every step's response is closed and
+// the returned Next carries the failed step's error. Otherwise every step is recorded in the chain, in the order
+// they were given.
+func (n *Next) Parallel(steps ...func(n *Next) *Response) *Next {
+	if n.err != nil {
+		return n
+	}
+	parent := n.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		responses = make([]*Response, len(steps))
+		failed    *Response
+	)
+	for i, step := range steps {
+		wg.Add(1)
+		go func(i int, step func(n *Next) *Response) {
+			defer wg.Done()
+			resp := step(&Next{steps: n.steps, ctx: ctx})
+			responses[i] = resp
+			if resp.req.err != nil {
+				mu.Lock()
+				if failed == nil {
+					failed = resp
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}(i, step)
+	}
+	wg.Wait()
+
+	if failed != nil {
+		for _, resp := range responses {
+			abandon(resp)
+		}
+		failed.req.err = failed.chainError()
+		return &Next{err: failed.req.err}
+	}
+	joined := make([]Step, len(n.steps), len(n.steps)+len(steps))
+	copy(joined, n.steps)
+	for _, resp := range responses {
+		joined = append(joined, resp.step())
+	}
+	return &Next{steps: joined, ctx: n.ctx}
+}
+
+// StepName names the request when it is part of a chain. The name is reported in
+// ChainError. It defaults to the request's method and path.
+func (r *Request) StepName(name string) *Request {
+	r.stepName = name
+	return r
+}
+
+// step describes this request as a step in its chain
+func (r *Response) step() Step {
+	step := Step{
+		Index: len(r.req.steps),
+		Name:  r.req.stepName,
+	}
+	step.Method = r.req.method
+	if r.req.URL != nil {
+		step.URL = r.req.URL.String()
+		if step.Name == "" {
+			step.Name = r.req.method + " " + r.req.URL.Path
+		}
+	}
+	if r.Response != nil {
+		step.StatusCode = r.Response.StatusCode
+	}
+	return step
+}
+
+// chainError wraps the request's error in a ChainError, unless it already is one
+func (r *Response) chainError() error {
+	if _, ok := r.req.err.(*ChainError); ok {
+		return r.req.err
+	}
+	return &ChainError{
+		Step:      r.step(),
+		Completed: r.req.steps,
+		Err:       r.req.err,
+	}
+}
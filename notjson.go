@@ -0,0 +1,44 @@
+package quest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// snippetSize is how much of a body NotJSONError quotes
+const snippetSize = 200
+
+// NotJSONError is returned by GetJSON when the body is clearly not JSON, such as
+// an HTML error page from a proxy or a plaintext message
+type NotJSONError struct {
+	StatusCode  int
+	ContentType string
+	Snippet     string
+}
+
+func (e *NotJSONError) Error() string {
+	return fmt.Sprintf("Invalid Body. Expected JSON, got %q with status '%d': %q", e.ContentType, e.StatusCode, e.Snippet)
+}
+
+// notJSON returns a *NotJSONError if b cannot start a JSON value
+func (r *Response) notJSON(b []byte) error {
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 || strings.IndexByte(`{["-0123456789tfn`, trimmed[0]) >= 0 {
+		return nil
+	}
+	return &NotJSONError{
+		StatusCode:  r.Response.StatusCode,
+		ContentType: r.Response.Header.Get("Content-Type"),
+		Snippet:     bodySnippet(trimmed),
+	}
+}
+
+// bodySnippet returns the start of b with whitespace collapsed, for error messages
+func bodySnippet(b []byte) string {
+	snippet := strings.Join(strings.Fields(string(b)), " ")
+	if len(snippet) > snippetSize {
+		snippet = snippet[:snippetSize] + "..."
+	}
+	return snippet
+}
@@ -0,0 +1,20 @@
+package quest
+
+// OperationName names the request in traces and metrics. It defaults to the method
+// and the url template the request was created from (e.g. "GET /users/:id") when
+// path params are used, keeping the number of distinct names low.
+func (r *Request) OperationName(name string) *Request {
+	r.operation = name
+	return r
+}
+
+// operationName returns the name of the request's operation, or "" if it has none
+func (r *Request) operationName() string {
+	if r.operation != "" {
+		return r.operation
+	}
+	if r.template != "" {
+		return r.method + " " + r.template
+	}
+	return ""
+}
@@ -0,0 +1,135 @@
+package quest
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ParamSyntax selects which placeholder syntax Param substitutes
+type ParamSyntax int
+
+const (
+	// ParamAny accepts both `:key` and `{key}` placeholders
+	ParamAny ParamSyntax = iota
+	// ParamColon accepts only `:key` placeholders
+	ParamColon
+	// ParamBraces accepts only `{key}` (OpenAPI style) placeholders
+	ParamBraces
+)
+
+// ParamSyntax sets which placeholder syntax Param substitutes in requests created by
+// this client
+func (c *Client) ParamSyntax(syntax ParamSyntax) *Client {
+	c.paramSyntax = syntax
+	return c
+}
+
+// Param replaces url param (denoted with `:key` or `{key}`) with given value. The
+// value is escaped so it cannot change the structure of the url, e.g. a "/" in it
+// does not add a path segment.
+func (r *Request) Param(key, value string) *Request {
+	return r.param(key, value, true)
+}
+
+// ParamRaw replaces url param like Param but without escaping value, e.g. to
+// substitute a path of several segments. Value must already be escaped where
+// needed.
+func (r *Request) ParamRaw(key, value string) *Request {
+	return r.param(key, value, false)
+}
+
+// Params replaces every url param named in params with its value, escaped as by
+// Param
+func (r *Request) Params(params map[string]string) *Request {
+	for _, key := range sortedKeys(params) {
+		r.param(key, params[key], true)
+	}
+	return r
+}
+
+// ParamInt replaces url param like Param with the decimal form of value
+func (r *Request) ParamInt(key string, value int) *Request {
+	return r.param(key, strconv.Itoa(value), true)
+}
+
+func (r *Request) param(key, value string, escape bool) *Request {
+	if r.err != nil {
+		return r
+	}
+
+	syntax := ParamAny
+	if r.client != nil {
+		syntax = r.client.paramSyntax
+	}
+
+	pathValue, queryValue := value, value
+	if escape {
+		pathValue, queryValue = url.PathEscape(value), url.QueryEscape(value)
+		if value == "." || value == ".." {
+			// dot segments would be resolved by the server
+			pathValue = strings.Repeat("%2E", len(value))
+		}
+	}
+
+	u := *r.URL
+	path, found := replaceParam(u.EscapedPath(), key, pathValue, syntax)
+	if found {
+		if r.template == "" {
+			r.template = r.URL.Path
+		}
+		unescaped, err := url.PathUnescape(path)
+		if err != nil {
+			r.err = handleRequestError(err, r)
+			return r
+		}
+		u.Path = unescaped
+		u.RawPath = path
+	} else if query, ok := replaceParam(u.RawQuery, key, queryValue, syntax); ok {
+		u.RawQuery = query
+	}
+	r.URL = &u
+	return r
+}
+
+// replaceParam replaces the first placeholder for key in s with value
+func replaceParam(s, key, value string, syntax ParamSyntax) (string, bool) {
+	if syntax != ParamBraces {
+		if out, ok := replaceColonParam(s, key, value); ok {
+			return out, true
+		}
+	}
+	if syntax != ParamColon {
+		// braces are escaped in paths so look for both forms
+		for _, placeholder := range []string{"{" + key + "}", "%7B" + key + "%7D", "%7b" + key + "%7d"} {
+			if i := strings.Index(s, placeholder); i >= 0 {
+				return s[:i] + value + s[i+len(placeholder):], true
+			}
+		}
+	}
+	return s, false
+}
+
+// replaceColonParam replaces the first `:key` in s that is not just the prefix of a
+// longer name (e.g. `:id` in `:idx`)
+func replaceColonParam(s, key, value string) (string, bool) {
+	placeholder := ":" + key
+	for i := 0; i < len(s); {
+		j := strings.Index(s[i:], placeholder)
+		if j < 0 {
+			break
+		}
+		start := i + j
+		end := start + len(placeholder)
+		if end < len(s) && isParamChar(s[end]) {
+			i = end
+			continue
+		}
+		return s[:start] + value + s[end:], true
+	}
+	return s, false
+}
+
+func isParamChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,271 @@
+package quest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phases of a request that can be given their own timeout
+const (
+	PhaseRequest        = "request"
+	PhaseDial           = "dial"
+	PhaseDNS            = "dns"
+	PhaseConnect        = "connect"
+	PhaseTLS            = "tls handshake"
+	PhaseResponseHeader = "response header"
+)
+
+// PhaseTimeoutError is returned when a phase of a request takes longer than the
+// timeout set for it
+type PhaseTimeoutError struct {
+	Phase string
+	Limit time.Duration
+}
+
+func (e *PhaseTimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Phase, e.Limit)
+}
+
+// Timeout reports true so the error behaves like other network timeouts
+func (e *PhaseTimeoutError) Timeout() bool {
+	return true
+}
+
+// phaseTimeouts are the per phase timeouts of a request
+type phaseTimeouts struct {
+	request        time.Duration
+	dial           time.Duration
+	dns            time.Duration
+	connect        time.Duration
+	tls            time.Duration
+	responseHeader time.Duration
+}
+
+// Timeout limits how long the whole request may take, from sending it until its
+// response body has been read. A request still running when it expires fails with a
+// *PhaseTimeoutError for PhaseRequest.
+func (r *Request) Timeout(d time.Duration) *Request {
+	r.phases.request = d
+	return r
+}
+
+// DialTimeout limits how long opening a connection may take, including resolving
+// the host and trying each of its addresses
+func (r *Request) DialTimeout(d time.Duration) *Request {
+	r.phases.dial = d
+	return r
+}
+
+// DNSTimeout limits how long resolving the request's host may take
+func (r *Request) DNSTimeout(d time.Duration) *Request {
+	r.phases.dns = d
+	return r
+}
+
+// ConnectTimeout limits how long opening a TCP connection may take, per address
+// that is tried
+func (r *Request) ConnectTimeout(d time.Duration) *Request {
+	r.phases.connect = d
+	return r
+}
+
+// TLSHandshakeTimeout limits how long the TLS handshake may take
+func (r *Request) TLSHandshakeTimeout(d time.Duration) *Request {
+	r.phases.tls = d
+	return r
+}
+
+// ResponseHeaderTimeout limits how long to wait for the response headers once the
+// request has been written
+func (r *Request) ResponseHeaderTimeout(d time.Duration) *Request {
+	r.phases.responseHeader = d
+	return r
+}
+
+// DialTimeout sets DialTimeout for every request from this client
+func (c *Client) DialTimeout(d time.Duration) *Client {
+	c.phases.dial = d
+	return c
+}
+
+// DNSTimeout sets DNSTimeout for every request from this client
+func (c *Client) DNSTimeout(d time.Duration) *Client {
+	c.phases.dns = d
+	return c
+}
+
+// ConnectTimeout sets ConnectTimeout for every request from this client
+func (c *Client) ConnectTimeout(d time.Duration) *Client {
+	c.phases.connect = d
+	return c
+}
+
+// TLSHandshakeTimeout sets TLSHandshakeTimeout for every request from this client
+func (c *Client) TLSHandshakeTimeout(d time.Duration) *Client {
+	c.phases.tls = d
+	return c
+}
+
+// ResponseHeaderTimeout sets ResponseHeaderTimeout for every request from this client
+func (c *Client) ResponseHeaderTimeout(d time.Duration) *Client {
+	c.phases.responseHeader = d
+	return c
+}
+
+// phaseTimeouts returns the request's phase timeouts, falling back to the client's
+func (r *Request) phaseTimeouts() phaseTimeouts {
+	phases := r.phases
+	if r.client != nil {
+		if phases.request <= 0 {
+			phases.request = r.client.phases.request
+		}
+		if phases.dial <= 0 {
+			phases.dial = r.client.phases.dial
+		}
+		if phases.dns <= 0 {
+			phases.dns = r.client.phases.dns
+		}
+		if phases.connect <= 0 {
+			phases.connect = r.client.phases.connect
+		}
+		if phases.tls <= 0 {
+			phases.tls = r.client.phases.tls
+		}
+		if phases.responseHeader <= 0 {
+			phases.responseHeader = r.client.phases.responseHeader
+		}
+	}
+	return phases
+}
+
+func (p phaseTimeouts) enabled() bool {
+	return p.request > 0 || p.dial > 0 || p.dns > 0 || p.connect > 0 || p.tls > 0 || p.responseHeader > 0
+}
+
+// phaseTimer enforces phase timeouts by cancelling the request's context when a
+// phase runs too long
+type phaseTimer struct {
+	timeouts phaseTimeouts
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	timers  map[string]*time.Timer
+	expired *PhaseTimeoutError
+}
+
+// attach returns req with its phases timed
+func (p *phaseTimer) attach(req *http.Request) *http.Request {
+	ctx, cancel := context.WithCancel(req.Context())
+	p.cancel = cancel
+	p.timers = map[string]*time.Timer{}
+	p.start(PhaseRequest, PhaseRequest, p.timeouts.request)
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			p.startIdle(PhaseDial, p.timeouts.dial)
+			p.start(PhaseDNS, PhaseDNS, p.timeouts.dns)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) { p.stop(PhaseDNS) },
+		ConnectStart: func(network, addr string) {
+			p.startIdle(PhaseDial, p.timeouts.dial)
+			p.start(PhaseConnect+" "+addr, PhaseConnect, p.timeouts.connect)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			p.stop(PhaseConnect + " " + addr)
+			if err == nil {
+				p.stop(PhaseDial)
+			}
+		},
+		TLSHandshakeStart: func() {
+			p.start(PhaseTLS, PhaseTLS, p.timeouts.tls)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) { p.stop(PhaseTLS) },
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			p.start(PhaseResponseHeader, PhaseResponseHeader, p.timeouts.responseHeader)
+		},
+		GotFirstResponseByte: func() { p.stop(PhaseResponseHeader) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(ctx, trace))
+}
+
+func (p *phaseTimer) start(key, phase string, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.timers[key]; ok {
+		t.Stop()
+	}
+	p.timers[key] = time.AfterFunc(timeout, func() {
+		p.mu.Lock()
+		if p.expired == nil {
+			p.expired = &PhaseTimeoutError{Phase: phase, Limit: timeout}
+		}
+		p.mu.Unlock()
+		p.cancel()
+	})
+}
+
+// startIdle starts timing phase unless it is already being timed
+func (p *phaseTimer) startIdle(phase string, timeout time.Duration) {
+	p.mu.Lock()
+	_, running := p.timers[phase]
+	p.mu.Unlock()
+	if !running {
+		p.start(phase, phase, timeout)
+	}
+}
+
+func (p *phaseTimer) stop(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.timers[key]; ok {
+		t.Stop()
+		delete(p.timers, key)
+	}
+}
+
+// finish stops the timers once the round trip is over. The request timer keeps
+// running, and the context is kept, until the response body is closed.
+func (p *phaseTimer) finish(resp *http.Response, err error) (*http.Response, error) {
+	p.mu.Lock()
+	for key, t := range p.timers {
+		if key != PhaseRequest {
+			t.Stop()
+			delete(p.timers, key)
+		}
+	}
+	expired := p.expired
+	p.mu.Unlock()
+
+	if err != nil {
+		p.close()
+		if expired != nil {
+			return resp, expired
+		}
+		return resp, err
+	}
+	resp.Body = &cancelOnClose{resp.Body, p.close}
+	return resp, nil
+}
+
+// expiredError returns the timeout that cancelled the request, if any
+func (p *phaseTimer) expiredError() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.expired == nil {
+		return nil
+	}
+	return p.expired
+}
+
+// close stops the request timer and releases the context
+func (p *phaseTimer) close() {
+	p.stop(PhaseRequest)
+	p.cancel()
+}
@@ -0,0 +1,118 @@
+package quest
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultDurationBuckets and DefaultSizeBuckets are the histogram buckets of the
+// metrics registered by EnableMetrics, in seconds and bytes
+var (
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	DefaultSizeBuckets     = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+// requestLabels label the request count, duration and size metrics
+var requestLabels = []string{"method", "host", "status_class"}
+
+// collectors are the Prometheus metrics registered by EnableMetrics
+type collectors struct {
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	inFlight      prometheus.Gauge
+	requestBytes  *prometheus.HistogramVec
+	responseBytes *prometheus.HistogramVec
+	dnsErrors     *prometheus.CounterVec
+}
+
+func newCollectors() *collectors {
+	return &collectors{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MetricRequests,
+			Help: "Requests sent, by method, host and status class.",
+		}, requestLabels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    MetricRequestDuration,
+			Help:    "Time until the response headers were received, in seconds.",
+			Buckets: DefaultDurationBuckets,
+		}, requestLabels),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: MetricInFlight,
+			Help: "Requests waiting for their response headers.",
+		}),
+		requestBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    MetricRequestBytes,
+			Help:    "Size of the request bodies sent, in bytes.",
+			Buckets: DefaultSizeBuckets,
+		}, requestLabels),
+		responseBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    MetricResponseBytes,
+			Help:    "Size of the response bodies read, in bytes.",
+			Buckets: DefaultSizeBuckets,
+		}, requestLabels),
+		dnsErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MetricDNSErrors,
+			Help: "Requests that failed because their host could not be resolved, by host and kind.",
+		}, []string{"host", "kind"}),
+	}
+}
+
+// register registers every collector with registerer. A collector that is already
+// registered (e.g. by an earlier call of EnableMetrics) is reused.
+func (c *collectors) register(registerer prometheus.Registerer) error {
+	register := func(collector prometheus.Collector) (prometheus.Collector, error) {
+		err := registerer.Register(collector)
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			return registered.ExistingCollector, nil
+		}
+		return collector, err
+	}
+	var err error
+	var collector prometheus.Collector
+	if collector, err = register(c.requests); err != nil {
+		return err
+	}
+	c.requests = collector.(*prometheus.CounterVec)
+	if collector, err = register(c.duration); err != nil {
+		return err
+	}
+	c.duration = collector.(*prometheus.HistogramVec)
+	if collector, err = register(c.inFlight); err != nil {
+		return err
+	}
+	c.inFlight = collector.(prometheus.Gauge)
+	if collector, err = register(c.requestBytes); err != nil {
+		return err
+	}
+	c.requestBytes = collector.(*prometheus.HistogramVec)
+	if collector, err = register(c.responseBytes); err != nil {
+		return err
+	}
+	c.responseBytes = collector.(*prometheus.HistogramVec)
+	if collector, err = register(c.dnsErrors); err != nil {
+		return err
+	}
+	c.dnsErrors = collector.(*prometheus.CounterVec)
+	return nil
+}
+
+// observe records m if it is one of the collected metrics
+func (c *collectors) observe(m Metric) {
+	request := func() []string {
+		return []string{m.Labels["method"], m.Labels["host"], m.Labels["status_class"]}
+	}
+	switch m.Name {
+	case MetricRequests:
+		c.requests.WithLabelValues(request()...).Add(m.Value)
+	case MetricRequestDuration:
+		c.duration.WithLabelValues(request()...).Observe(m.Value)
+	case MetricRequestBytes:
+		c.requestBytes.WithLabelValues(request()...).Observe(m.Value)
+	case MetricResponseBytes:
+		c.responseBytes.WithLabelValues(request()...).Observe(m.Value)
+	case MetricDNSErrors:
+		c.dnsErrors.WithLabelValues(m.Labels["host"], m.Labels["kind"]).Add(m.Value)
+	}
+}
@@ -0,0 +1,59 @@
+package quest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// MaxProtobufMessageSize is the largest message EachProtobuf accepts, guarding
+// against a corrupt length prefix allocating huge buffers
+var MaxProtobufMessageSize = 64 << 20
+
+// EachProtobuf reads a length-prefixed protobuf stream (application/x-protobuf-stream)
+// from the body and calls fn with each serialized message as it arrives, so large
+// exports are never held in memory at once. Each message is prefixed with its size
+// as a varint, as written by Java's writeDelimitedTo or Go's protodelim. The slice
+// passed to fn is reused for the next message. An error returned by fn stops the
+// stream and fails the chain. The body is consumed and cannot be read again.
+func (r *Response) EachProtobuf(fn func(msg []byte) error) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	r.rewindBody()
+	body := r.Response.Body
+	defer body.Close()
+	r.Response.Body = http.NoBody
+
+	reader := bufio.NewReader(body)
+	var buf []byte
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return r
+		}
+		if err == nil && size > uint64(MaxProtobufMessageSize) {
+			err = fmt.Errorf("Invalid Message. Expected at most %d bytes, got %d", MaxProtobufMessageSize, size)
+		}
+		if err == nil {
+			if uint64(cap(buf)) < size {
+				buf = make([]byte, size)
+			}
+			buf = buf[:size]
+			_, err = io.ReadFull(reader, buf)
+		}
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			err = fn(buf)
+		}
+		if err != nil {
+			r.req.err = handleResponseError(err, r.req, r)
+			return r
+		}
+	}
+}
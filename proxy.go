@@ -0,0 +1,180 @@
+package quest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval is how often Proxy flushes an http.Flusher it is writing to
+const DefaultFlushInterval = 100 * time.Millisecond
+
+// DefaultProxyHeaders are the response headers Proxy copies to an http.ResponseWriter
+// when none are given
+var DefaultProxyHeaders = []string{
+	"Content-Type",
+	"Content-Encoding",
+	"Content-Disposition",
+	"Cache-Control",
+	"Etag",
+	"Last-Modified",
+}
+
+// FlushInterval sets how often Proxy flushes its target when it is an http.Flusher.
+// A negative value flushes after every write.
+func (r *Response) FlushInterval(d time.Duration) *Response {
+	r.flushInterval = &d
+	return r
+}
+
+// ProxyN copies at most max bytes of the response body to a given writer and
+// errors if the body is larger. Unlike Proxy the body is streamed without being
+// buffered, so it cannot be read again afterwards.
+func (r *Response) ProxyN(w io.Writer, max int64) *Response {
+	return r.proxyStream(context.Background(), w, max, nil)
+}
+
+// ProxyContext copies the body of the response to a given writer, stopping when ctx
+// is done. Unlike Proxy the body is streamed without being buffered, so it cannot
+// be read again afterwards.
+func (r *Response) ProxyContext(ctx context.Context, w io.Writer) *Response {
+	return r.proxyStream(ctx, w, -1, nil)
+}
+
+// proxyStream copies the body to w until it is exhausted, max bytes (when not
+// negative) were exceeded or ctx is done. headers are copied to w as by Proxy.
+func (r *Response) proxyStream(ctx context.Context, w io.Writer, max int64, headers []string) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	r.rewindBody()
+	body := r.Response.Body
+	defer body.Close()
+	r.Response.Body = http.NoBody
+
+	// closing the body unblocks a read that is stuck waiting on the upstream
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			body.Close()
+		case <-done:
+		}
+	}()
+
+	var src io.Reader = &contextReader{ctx, body}
+	if max >= 0 {
+		src = io.LimitReader(src, max)
+	}
+
+	dst, stop := r.proxyWriter(w, headers)
+	_, err := io.Copy(dst, src)
+	stop()
+	if err == nil && max >= 0 {
+		var probe [1]byte
+		if n, _ := body.Read(probe[:]); n > 0 {
+			err = fmt.Errorf("Invalid Body. Expected at most %d bytes", max)
+		}
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+	}
+	return r
+}
+
+// contextReader stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// proxyWriter prepares w to receive the response body. When w is an
+// http.ResponseWriter the status code and given headers are copied to it and when
+// it is an http.Flusher the returned writer flushes it periodically.
+func (r *Response) proxyWriter(w io.Writer, headers []string) (io.Writer, func()) {
+	if rw, ok := w.(http.ResponseWriter); ok {
+		if headers == nil {
+			headers = DefaultProxyHeaders
+		}
+		for _, key := range headers {
+			for _, value := range r.Response.Header[http.CanonicalHeaderKey(key)] {
+				rw.Header().Add(key, value)
+			}
+		}
+		rw.WriteHeader(r.Response.StatusCode)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return w, func() {}
+	}
+
+	interval := DefaultFlushInterval
+	if strings.HasPrefix(r.Response.Header.Get("Content-Type"), "text/event-stream") {
+		interval = -1
+	}
+	if r.flushInterval != nil {
+		interval = *r.flushInterval
+	}
+	fw := &flushWriter{w: w, flusher: flusher, interval: interval}
+	return fw, fw.stop
+}
+
+// flushWriter flushes the underlying writer at most once per interval
+type flushWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	flusher  http.Flusher
+	interval time.Duration
+	timer    *time.Timer
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if f.interval < 0 {
+		f.flusher.Flush()
+	} else if f.timer == nil {
+		f.timer = time.AfterFunc(f.interval, f.delayedFlush)
+	}
+	return n, nil
+}
+
+func (f *flushWriter) delayedFlush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.timer == nil {
+		return
+	}
+	f.flusher.Flush()
+	f.timer = nil
+}
+
+func (f *flushWriter) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.flusher.Flush()
+}
@@ -0,0 +1,136 @@
+package quest
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// QueryMap adds every key and value of params to the url as query params, in
+// sorted key order
+func (r *Request) QueryMap(params map[string]string) *Request {
+	for _, key := range sortedKeys(params) {
+		r.QueryParam(key, params[key])
+	}
+	return r
+}
+
+// QueryStruct adds the exported fields of v, a struct or a pointer to one, to the
+// url as query params. The `url` tag names a field's param, "-" skips it and the
+// omitempty option skips its zero value, e.g. `url:"page_size,omitempty"`. Slices
+// become arrays and nested structs and maps nested keys, encoded as set with
+// FormEncoding. Times are formatted as RFC 3339.
+func (r *Request) QueryStruct(v interface{}) *Request {
+	if r.err != nil {
+		return r
+	}
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		r.err = handleRequestError(fmt.Errorf("cannot encode %T as query params, expected a struct", v), r)
+		return r
+	}
+	opts, _ := r.formOptions()
+	for _, p := range structFormParams(value) {
+		r.addQuery(p, opts)
+	}
+	return r
+}
+
+// structFormParams returns the fields of the struct v as form params
+func structFormParams(v reflect.Value) []formParam {
+	var params []formParam
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, omitEmpty := field.Name, false
+		if tag, ok := field.Tag.Lookup("url"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, option := range parts[1:] {
+				omitEmpty = omitEmpty || option == "omitempty"
+			}
+		}
+
+		fv := v.Field(i)
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		if _, tagged := field.Tag.Lookup("url"); field.Anonymous && !tagged {
+			// embedded structs are flattened into their parent
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				params = append(params, structFormParams(fv)...)
+			}
+			continue
+		}
+		if value, ok := formValue(fv); ok {
+			params = append(params, formParam{name, value})
+		}
+	}
+	return params
+}
+
+// formValue converts v into a string, a []string or a map of nested values. ok is
+// false for nil pointers and values that cannot be encoded, like funcs.
+func formValue(v reflect.Value) (interface{}, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339), true
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return string(text), err == nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		values := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if item, ok := formValue(v.Index(i)); ok {
+				values = append(values, fmt.Sprint(item))
+			}
+		}
+		return values, true
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		nested := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if item, ok := formValue(iter.Value()); ok {
+				nested[iter.Key().String()] = item
+			}
+		}
+		return nested, true
+	case reflect.Struct:
+		nested := map[string]interface{}{}
+		for _, p := range structFormParams(v) {
+			nested[p.key] = p.value
+		}
+		return nested, true
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Invalid:
+		return nil, false
+	}
+	return fmt.Sprint(v.Interface()), true
+}
@@ -1,10 +1,39 @@
 package quest
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nicksrandall/quest/questmultipart"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const TestString = "Hello, world!"
@@ -79,3 +108,3486 @@ func Example() {
 
 	// do something with body
 }
+
+func TestClientMaxConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, TestString)
+	}))
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var maxQueued float64
+	client := NewClient().
+		MaxConcurrent(1).
+		QueueTimeout(50 * time.Millisecond).
+		WithMetrics(func(m Metric) {
+			mu.Lock()
+			defer mu.Unlock()
+			if m.Name == MetricQueued && m.Value > maxQueued {
+				maxQueued = m.Value
+			}
+		})
+
+	done := make(chan *Response)
+	go func() {
+		done <- client.Get(ts.URL).Send().ExpectSuccess()
+	}()
+	for client.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	err := client.Get(ts.URL).Send().Done()
+	if err == nil || !strings.Contains(err.Error(), ErrQueueTimeout.Error()) {
+		t.Errorf("Expected queue timeout error, got %v", err)
+	}
+
+	close(release)
+	resp := <-done
+	if err := resp.Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if client.InFlight() != 1 {
+		t.Errorf("Expected the slot to be held until the body is closed, got %d in flight", client.InFlight())
+	}
+	var body string
+	resp.GetBody(&body)
+	if client.InFlight() != 0 || client.Queued() != 0 {
+		t.Errorf("Expected limiter to be empty, got %d in flight and %d queued", client.InFlight(), client.Queued())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxQueued != 1 {
+		t.Errorf("Expected queued gauge to reach 1, got %v", maxQueued)
+	}
+}
+
+func TestRedirectCredentials(t *testing.T) {
+	var got string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer target.Close()
+
+	// same ip, different host name so the redirect is cross-origin
+	location := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+	ts := httptest.NewServer(http.RedirectHandler(location, http.StatusFound))
+	defer ts.Close()
+
+	err := Get(ts.URL).BasicAuth("user", "pass").Send().ExpectSuccess().Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if got != "" {
+		t.Errorf("Expected Authorization to be stripped, got %q", got)
+	}
+
+	err = Get(ts.URL).
+		BasicAuth("user", "pass").
+		AllowRedirectCredentials("localhost").
+		Send().
+		ExpectSuccess().
+		Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if got == "" {
+		t.Error("Expected Authorization to be forwarded to allowed host")
+	}
+
+	// the client's hosts are not appended into the request's spare capacity
+	req := NewClient().AllowRedirectCredentials("client.example.com").Get(ts.URL)
+	req.redirectHosts = append(make([]string, 0, 4), "request.example.com")
+	origin, _ := http.NewRequest(http.MethodGet, "http://origin.example.com", nil)
+	redirect, _ := http.NewRequest(http.MethodGet, "http://client.example.com", nil)
+	if err := req.checkRedirect(redirect, []*http.Request{origin}); err != nil {
+		t.Fatal(err)
+	}
+	if spare := req.redirectHosts[:2]; spare[1] != "" {
+		t.Errorf("Expected the request's hosts to be left alone, got %q", spare)
+	}
+}
+
+func TestProxyResponseWriter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set(Header, "not-copied")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, TestString)
+	}))
+	defer ts.Close()
+
+	rec := httptest.NewRecorder()
+	var body string
+	err := Get(ts.URL).Send().Proxy(rec).GetBody(&body).Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("Expected status to be copied, got %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Type") != "text/event-stream" || rec.Header().Get(Header) != "" {
+		t.Errorf("Unexpected proxied headers: %v", rec.Header())
+	}
+	if !rec.Flushed {
+		t.Error("Expected proxy target to be flushed")
+	}
+	if rec.Body.String() != TestString || body != TestString {
+		t.Errorf("Response body did not match: %q, %q", rec.Body.String(), body)
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer good.Close()
+
+	fan := FanOut(Get("http://example.com/some/path"), []string{bad.URL, good.URL})
+
+	var body string
+	err := fan.FirstSuccess().GetBody(&body).Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if body != "/some/path" {
+		t.Errorf("Response body did not match: %q", body)
+	}
+
+	responses := fan.All()
+	if len(responses) != 2 || responses[0].StatusCode != 500 || responses[1].StatusCode != 200 {
+		t.Errorf("Unexpected fan out responses: %v", responses)
+	}
+
+	// the first success is returned without waiting for slower targets
+	release := make(chan struct{})
+	defer close(release)
+	client := NewClient().Transport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "slow.test" {
+			<-release
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(req.URL.Host)), Request: req}, nil
+	}))
+	err = FanOut(client.Get("http://example.com/"), []string{"slow.test", "fast.test"}).FirstSuccess().GetBody(&body).Done()
+	if err != nil || body != "fast.test" {
+		t.Errorf("Unexpected first success %q, %v", body, err)
+	}
+
+	// the template request is left usable without targets
+	template := Get(good.URL + "/template")
+	if err := FanOut(template, nil).FirstSuccess().Done(); err == nil {
+		t.Error("Expected an error without targets")
+	}
+	if err := template.Send().GetBody(&body).Done(); err != nil || body != "/template" {
+		t.Errorf("Expected the template request to be unchanged, got %q, %v", body, err)
+	}
+}
+
+func TestExpectLatencyUnder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	if err := Get(ts.URL).Send().ExpectLatencyUnder(time.Minute).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if err := Get(ts.URL).Send().ExpectLatencyUnder(time.Millisecond).Done(); err == nil {
+		t.Error("Expected latency error")
+	}
+}
+
+func TestGetHeaderTyped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	}))
+	defer ts.Close()
+
+	var n int
+	var modified time.Time
+	err := Get(ts.URL).
+		Send().
+		GetHeaderInt("X-RateLimit-Remaining", &n).
+		GetHeaderTime("Last-Modified", &modified).
+		Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if n != 42 || modified.Year() != 2006 {
+		t.Errorf("Unexpected header values: %d, %v", n, modified)
+	}
+
+	if err := Get(ts.URL).Send().GetHeaderInt("Last-Modified", &n).Done(); err == nil {
+		t.Error("Expected header parse error")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "1")
+	}))
+	defer ts.Close()
+
+	client := NewClient().RespectRateLimit()
+	limit, remaining, reset := client.Get(ts.URL).Send().RateLimit()
+	if limit != 100 || remaining != 0 || reset.IsZero() {
+		t.Errorf("Unexpected rate limit: %d, %d, %v", limit, remaining, reset)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := client.Get(ts.URL).WithContext(ctx).Send().Done(); err == nil {
+		t.Error("Expected request to wait for the rate limit to reset")
+	}
+
+	// with a fake clock the wait is instant
+	client.WithClock(fixedClock(time.Now()))
+	if err := client.Get(ts.URL).Send().Done(); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestCapture(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Add("Link", "<a>")
+		w.Header().Add("Link", "<b>")
+		w.Header().Set("X-Count", "3")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"name":"quest"}`)
+	}))
+	defer ts.Close()
+
+	var result struct {
+		Status int      `quest:"status"`
+		ETag   string   `quest:"header:ETag"`
+		Links  []string `quest:"header:Link"`
+		Count  int      `quest:"header:X-Count"`
+		Raw    string   `quest:"body"`
+		Body   struct {
+			Name string `json:"name"`
+		} `quest:"body"`
+		hidden string `quest:"header:ETag"`
+	}
+	var body string
+	err := Get(ts.URL).Send().Capture(&result).GetBody(&body).Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if result.Status != 201 || result.ETag != `"abc"` || len(result.Links) != 2 || result.Count != 3 {
+		t.Errorf("Unexpected captured headers: %+v", result)
+	}
+	if result.Body.Name != "quest" || result.Raw != body {
+		t.Errorf("Unexpected captured body: %+v, %q", result, body)
+	}
+}
+
+func TestFileBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != int64(len(TestString)) {
+			t.Errorf("Unexpected Content-Length: %d", r.ContentLength)
+		}
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "quest-*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprint(f, TestString)
+	f.Close()
+
+	var body string
+	err = Put(ts.URL).
+		FileBody(f.Name(), "").
+		Send().
+		ExpectType("text").
+		GetBody(&body).
+		Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if body != TestString {
+		t.Errorf("Response body did not match: %q, %q", body, TestString)
+	}
+}
+
+type testContextKey string
+
+func TestWithValue(t *testing.T) {
+	key := testContextKey("tenant")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := Get("/").WithContext(ctx).WithValue(key, "acme")
+	if req.Context().Value(key) != "acme" {
+		t.Error("Expected value on request context")
+	}
+	cancel()
+	if req.Context().Err() == nil {
+		t.Error("Expected value context to derive from request context")
+	}
+}
+
+func TestGetJSONOptional(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("empty") != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fmt.Fprint(w, `{"name":"quest"}`)
+	}))
+	defer ts.Close()
+
+	var body map[string]string
+	if err := Get(ts.URL).QueryParam("empty", "true").Send().GetJSONOptional(&body).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if body != nil {
+		t.Errorf("Expected no value, got %v", body)
+	}
+	if err := Get(ts.URL).QueryParam("empty", "true").Send().GetJSON(&body).Done(); err == nil {
+		t.Error("Expected GetJSON to fail on an empty body")
+	}
+	if err := Get(ts.URL).Send().GetJSONOptional(&body).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if body["name"] != "quest" {
+		t.Errorf("Unexpected body: %v", body)
+	}
+}
+
+func TestRetryStaleConnection(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			// simulate the server dropping the connection without a response
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		fmt.Fprint(w, TestString)
+	}))
+	defer ts.Close()
+
+	var body string
+	if err := Get(ts.URL).Send().GetBody(&body).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if body != TestString || calls != 2 {
+		t.Errorf("Expected request to be retried once, got %d calls and body %q", calls, body)
+	}
+
+	mu.Lock()
+	calls = 0
+	mu.Unlock()
+	if err := Post(ts.URL).Send().Done(); err == nil {
+		t.Error("Expected non-idempotent request not to be retried")
+	}
+}
+
+func TestClientDialContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var networks []string
+	var d net.Dialer
+	client := NewClient().
+		PreferIPv4().
+		KeepAlive(-1).
+		DialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+			networks = append(networks, network)
+			return d.DialContext(ctx, network, address)
+		})
+
+	if err := client.Get(ts.URL).Send().ExpectSuccess().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if len(networks) != 1 || networks[0] != "tcp4" {
+		t.Errorf("Expected a single tcp4 dial, got %v", networks)
+	}
+}
+
+func TestBodyRereadable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	req := Post(ts.URL).JSONBody(map[string]string{"name": "quest"})
+	for i := 0; i < 2; i++ {
+		var body string
+		if err := req.Send().GetBody(&body).Done(); err != nil {
+			t.Error(err.Error())
+		}
+		if body != `{"name":"quest"}` {
+			t.Errorf("Response body did not match on send %d: %q", i, body)
+		}
+	}
+
+	rc, err := req.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(rc)
+	if string(b) != `{"name":"quest"}` {
+		t.Errorf("Expected request body to be re-readable, got %q", b)
+	}
+}
+
+func TestChainError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	err := Get(ts.URL + "/user").
+		StepName("fetch user").
+		Send().
+		ExpectSuccess().
+		Next().
+		Get(ts.URL + "/bad").
+		Send().
+		ExpectSuccess().
+		Next().
+		Get(ts.URL + "/never").
+		Send().
+		Done()
+
+	var chainErr *ChainError
+	if !errors.As(err, &chainErr) {
+		t.Fatalf("Expected a ChainError, got %v", err)
+	}
+	if chainErr.Step.Index != 1 || chainErr.Step.Name != "GET /bad" || chainErr.Step.StatusCode != 404 {
+		t.Errorf("Unexpected failed step: %+v", chainErr.Step)
+	}
+	if len(chainErr.Completed) != 1 || chainErr.Completed[0].Name != "fetch user" {
+		t.Errorf("Unexpected completed steps: %+v", chainErr.Completed)
+	}
+}
+
+func TestExpectRedirect(t *testing.T) {
+	ts := httptest.NewServer(http.RedirectHandler("/login?next=home", http.StatusFound))
+	defer ts.Close()
+
+	var location string
+	err := Get(ts.URL + "/home").
+		NoRedirects().
+		Send().
+		ExpectRedirect(http.StatusFound).
+		GetLocation(&location).
+		Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if location != ts.URL+"/login?next=home" {
+		t.Errorf("Unexpected location: %q", location)
+	}
+
+	if err := Get(ts.URL).NoRedirects().Send().ExpectRedirect(http.StatusMovedPermanently).Done(); err == nil {
+		t.Error("Expected redirect code mismatch error")
+	}
+}
+
+func TestAdaptiveThrottle(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("busy") != "" {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer ts.Close()
+
+	var rates []float64
+	client := NewClient().
+		AdaptiveThrottle(ThrottleSettings{MaxRate: 100, Increase: 10}).
+		WithMetrics(func(m Metric) {
+			if m.Name == MetricThrottleRate {
+				rates = append(rates, m.Value)
+			}
+		})
+
+	client.Get(ts.URL).QueryParam("busy", "true").Send()
+	client.Get(ts.URL).QueryParam("busy", "true").Send()
+	client.Get(ts.URL).Send()
+	if len(rates) != 3 || rates[0] != 50 || rates[1] != 25 || rates[2] != 35 {
+		t.Errorf("Unexpected throttle rates: %v", rates)
+	}
+}
+
+func TestScopedHeader(t *testing.T) {
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(Header)
+	}))
+	defer ts.Close()
+
+	client := NewClient().ScopedHeader("127.0.0.1", Header, "internal-token")
+
+	if err := client.Get(ts.URL).Send().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if got != "internal-token" {
+		t.Errorf("Expected scoped header to be sent to matching host, got %q", got)
+	}
+
+	if err := client.Get(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)).Send().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if got != "" {
+		t.Errorf("Expected scoped header not to be sent to other hosts, got %q", got)
+	}
+}
+
+func TestProxyN(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, TestString)
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	if err := Get(ts.URL).Send().ProxyN(&buf, int64(len(TestString))).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if buf.String() != TestString {
+		t.Errorf("Proxied body did not match: %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := Get(ts.URL).Send().ProxyN(&buf, 5).Done(); err == nil {
+		t.Error("Expected body size error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Get(ts.URL).Send().ProxyContext(ctx, &buf).Done(); err == nil {
+		t.Error("Expected context error")
+	}
+}
+
+func TestSizes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	sizes := map[string]float64{}
+	client := NewClient().WithMetrics(func(m Metric) {
+		sizes[m.Name] = m.Value
+	})
+
+	var body string
+	resp := client.Post(ts.URL).Body(bytes.NewBufferString(TestString)).Send()
+	if err := resp.GetBody(&body).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	n := int64(len(TestString))
+	if resp.BytesWritten() != n || resp.BytesRead() != n {
+		t.Errorf("Unexpected sizes: %d written, %d read", resp.BytesWritten(), resp.BytesRead())
+	}
+	if sizes[MetricRequestBytes] != float64(n) || sizes[MetricResponseBytes] != float64(n) {
+		t.Errorf("Unexpected size metrics: %v", sizes)
+	}
+}
+
+func TestExpectEncoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, TestString)
+		gz.Close()
+	}))
+	defer ts.Close()
+
+	var body string
+	if err := Get(ts.URL).Send().ExpectEncoding("gzip").GetBody(&body).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if body != TestString {
+		t.Errorf("Response body did not match: %q", body)
+	}
+	if err := Get(ts.URL).Send().ExpectEncoding("br").Done(); err == nil {
+		t.Error("Expected encoding error")
+	}
+}
+
+func TestGRPCWeb(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		// echo the request message back followed by a trailer frame
+		w.Write(b)
+		trailer := []byte("grpc-status: 0\r\ngrpc-message: OK\r\n")
+		w.Write([]byte{0x80, 0, 0, 0, byte(len(trailer))})
+		w.Write(trailer)
+	}))
+	defer ts.Close()
+
+	var msg []byte
+	err := Post(ts.URL + "/pkg.Service/Method").
+		GRPCWebBody([]byte(TestString)).
+		Send().
+		ExpectSuccess().
+		GetGRPCWeb(&msg).
+		Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if string(msg) != TestString {
+		t.Errorf("Unexpected grpc-web message: %q", msg)
+	}
+
+	// a corrupt frame header claiming a 4 GiB message
+	huge := bytes.NewBuffer([]byte{0, 0xff, 0xff, 0xff, 0xff})
+	err = Post(ts.URL + "/pkg.Service/Method").Body(huge).Send().GetGRPCWeb(&msg).Done()
+	if err == nil || !strings.Contains(err.Error(), "exceeds the maximum") {
+		t.Errorf("Expected an oversized frame to fail, got %v", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		writer := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			sub, err := http.ReadRequest(bufio.NewReader(part))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, _ := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/http"}})
+			fmt.Fprintf(out, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\n%s %s", sub.Method, sub.URL.Path)
+		}
+		writer.Close()
+	}))
+	defer ts.Close()
+
+	var responses []*Response
+	err := Batch(ts.URL+"/batch", Get("/users/1"), Delete("/users/2")).
+		Send().
+		ExpectSuccess().
+		GetBatch(&responses).
+		Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if len(responses) != 2 {
+		t.Fatalf("Expected 2 responses, got %d", len(responses))
+	}
+	for i, expected := range []string{"GET /users/1", "DELETE /users/2"} {
+		var body string
+		if err := responses[i].ExpectType("text").GetBody(&body).Done(); err != nil {
+			t.Error(err.Error())
+		}
+		if body != expected {
+			t.Errorf("Unexpected batch response %d: %q", i, body)
+		}
+	}
+}
+
+func TestCollectAll(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			fmt.Fprint(w, `{"items":[1,2],"next":"2"}`)
+		case "2":
+			fmt.Fprint(w, `{"items":[3,4],"next":"3"}`)
+		default:
+			fmt.Fprint(w, `{"items":[5]}`)
+		}
+	}))
+	defer ts.Close()
+
+	extract := func(resp *Response) ([]int, *Request, error) {
+		var page struct {
+			Items []int  `json:"items"`
+			Next  string `json:"next"`
+		}
+		resp.ExpectSuccess().GetJSON(&page)
+		if page.Next == "" {
+			return page.Items, nil, nil
+		}
+		return page.Items, Get(ts.URL).QueryParam("page", page.Next), nil
+	}
+
+	items, err := CollectAll(Get(ts.URL), extract, 0, 0)
+	if err != nil || len(items) != 5 {
+		t.Errorf("Unexpected collected items: %v, %v", items, err)
+	}
+
+	items, err = CollectAll(Get(ts.URL), extract, 3, 0)
+	if err != ErrCollectLimit || len(items) != 3 {
+		t.Errorf("Expected item cap, got %v, %v", items, err)
+	}
+
+	items, err = CollectAll(Get(ts.URL), extract, 0, 1)
+	if err != ErrCollectLimit || len(items) != 2 {
+		t.Errorf("Expected page cap, got %v, %v", items, err)
+	}
+}
+
+func TestParamSyntax(t *testing.T) {
+	req := Get("http://example.com/users/{id}/posts/:postId").
+		Param("id", "a b").
+		Param("postId", "7")
+	if req.URL.String() != "http://example.com/users/a%20b/posts/7" {
+		t.Errorf("Unexpected url: %q", req.URL.String())
+	}
+
+	req = NewClient().ParamSyntax(ParamBraces).Get("http://example.com/:id/{id}").Param("id", "1")
+	if req.URL.String() != "http://example.com/:id/1" {
+		t.Errorf("Unexpected url: %q", req.URL.String())
+	}
+
+	req = Get("http://example.com/:idx/:id").Param("id", "1")
+	if req.URL.String() != "http://example.com/:idx/1" {
+		t.Errorf("Unexpected url: %q", req.URL.String())
+	}
+}
+
+func TestParamEscaping(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected string
+	}{
+		{"a/b", "http://example.com/files/a%2Fb?v=1"},
+		{"a?b=c", "http://example.com/files/a%3Fb=c?v=1"},
+		{"a#b", "http://example.com/files/a%23b?v=1"},
+		{"..", "http://example.com/files/%2E%2E?v=1"},
+	}
+	for _, c := range cases {
+		req := Get("http://example.com/files/:name?v=1").Param("name", c.value)
+		if req.URL.String() != c.expected {
+			t.Errorf("Param(%q): expected %q, got %q", c.value, c.expected, req.URL.String())
+		}
+		if req.URL.RawQuery != "v=1" || req.URL.Fragment != "" {
+			t.Errorf("Param(%q) changed the url structure: %#v", c.value, req.URL)
+		}
+	}
+
+	req := Get("http://example.com/search?q=:q").Param("q", "a&b=c")
+	if req.URL.Query().Get("q") != "a&b=c" || len(req.URL.Query()) != 1 {
+		t.Errorf("Unexpected query %q", req.URL.RawQuery)
+	}
+
+	req = Get("http://example.com/files/:path").ParamRaw("path", "docs/readme.md")
+	if req.URL.String() != "http://example.com/files/docs/readme.md" {
+		t.Errorf("Unexpected raw url %q", req.URL.String())
+	}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func (c fixedClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- time.Time(c).Add(d)
+	return ch
+}
+
+func TestSignClockSkew(t *testing.T) {
+	serverTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+		signed, _ := http.ParseTime(r.Header.Get("X-Signed-At"))
+		if !signed.Equal(serverTime) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "<Code>RequestTimeTooSkewed</Code>")
+		}
+	}))
+	defer ts.Close()
+
+	var attempts int
+	client := NewClient().
+		WithClock(fixedClock(serverTime.Add(-time.Hour))).
+		Sign(func(req *http.Request, now time.Time) error {
+			attempts++
+			req.Header.Set("X-Signed-At", now.UTC().Format(http.TimeFormat))
+			return nil
+		})
+
+	if err := client.Get(ts.URL).Send().ExpectSuccess().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if attempts != 2 {
+		t.Errorf("Expected request to be signed twice, got %d", attempts)
+	}
+
+	// the learned offset is reused for the next request
+	if err := client.Get(ts.URL).Send().ExpectSuccess().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if attempts != 3 {
+		t.Errorf("Expected request to be signed once, got %d", attempts-2)
+	}
+}
+
+func TestLocalAddr(t *testing.T) {
+	var remote string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}))
+	defer ts.Close()
+
+	if err := Get(ts.URL).LocalAddr("127.0.0.1").Send().ExpectSuccess().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if remote != "127.0.0.1" {
+		t.Errorf("Unexpected remote address: %q", remote)
+	}
+	if err := Get(ts.URL).LocalAddr("not-an-ip").Send().Done(); err == nil {
+		t.Error("Expected invalid address error")
+	}
+
+	// bound requests follow dialer changes made after they were first sent
+	var dialed []string
+	dial := func(name string) func(ctx context.Context, network, address string) (net.Conn, error) {
+		return func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = append(dialed, name)
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		}
+	}
+	client := NewClient().DialContext(dial("first"))
+	if err := client.Get(ts.URL).LocalAddr("127.0.0.1").Send().ExpectSuccess().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	client.DialContext(dial("second"))
+	if err := client.Get(ts.URL).LocalAddr("127.0.0.1").Send().ExpectSuccess().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if strings.Join(dialed, ",") != "first,second" {
+		t.Errorf("Unexpected dials: %v", dialed)
+	}
+	if len(client.derived.transports) != 1 {
+		t.Errorf("Expected one bound transport, got %d", len(client.derived.transports))
+	}
+}
+
+func TestClientProxy(t *testing.T) {
+	var auth, path string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Proxy-Authorization")
+		path = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client := NewClient().Proxy(proxy.URL).ProxyAuth("user", "pass")
+	if err := client.Get("http://upstream.example.com/resource").Send().ExpectSuccess().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if path != "http://upstream.example.com/resource" {
+		t.Errorf("Expected request to go through the proxy, got %q", path)
+	}
+	if auth != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Unexpected Proxy-Authorization: %q", auth)
+	}
+}
+
+func TestMaxDecompressedSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(make([]byte, 100<<10))
+		gz.Close()
+	}))
+	defer ts.Close()
+
+	var body string
+	if err := Get(ts.URL).MaxDecompressedSize(1 << 20).Send().ExpectEncoding("gzip").GetBody(&body).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if len(body) != 100<<10 {
+		t.Errorf("Unexpected body length: %d", len(body))
+	}
+
+	err := NewClient().MaxDecompressedSize(10 << 10).Get(ts.URL).Send().GetBody(&body).Done()
+	if err == nil || !strings.Contains(err.Error(), "decompressed body exceeds") {
+		t.Errorf("Expected decompression error, got %v", err)
+	}
+}
+
+func TestExpectNoBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fmt.Fprint(w, "<html>oops</html>")
+	}))
+	defer ts.Close()
+
+	if err := Delete(ts.URL).Send().ExpectStatusCode(204).ExpectNoBody().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if err := Get(ts.URL).Send().ExpectNoBody().Done(); err == nil {
+		t.Error("Expected body error")
+	}
+}
+
+func TestAllowHosts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client := NewClient().AllowHosts("127.0.0.1", "*.example.com")
+	if err := client.Get(ts.URL).Send().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	err := client.Get("http://169.254.169.254/latest/meta-data").Send().Done()
+	if err == nil || !strings.Contains(err.Error(), ErrHostNotAllowed.Error()) {
+		t.Errorf("Expected host not allowed error, got %v", err)
+	}
+}
+
+func TestRequireTLS(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client := NewClient().RequireTLS()
+	err := client.Get(ts.URL).Send().Done()
+	if err == nil || !strings.Contains(err.Error(), ErrPlaintextNotAllowed.Error()) {
+		t.Errorf("Expected plaintext error, got %v", err)
+	}
+	if err := client.Get(ts.URL).AllowPlaintext().Send().Done(); err != nil {
+		t.Error(err.Error())
+	}
+
+	req := NewClient().UpgradeToTLS().Get("http://example.com/path")
+	if err := req.checkTLS(req.URL); err != nil || req.URL.Scheme != "https" {
+		t.Errorf("Expected url to be upgraded, got %q, %v", req.URL, err)
+	}
+}
+
+func TestHeaderLint(t *testing.T) {
+	var warnings []HeaderWarning
+	req := Get("http://example.com").
+		Header("content-type", "text/plain").
+		Header("Content-Type", "application/json").
+		Header("Content-Length", "10").
+		HeaderLint(func(w HeaderWarning) {
+			warnings = append(warnings, w)
+		})
+	if err := req.lintHeaders(); err != nil {
+		t.Error(err.Error())
+	}
+	if len(warnings) != 2 || warnings[0].Key != "Content-Length" || warnings[1].Key != "Content-Type" {
+		t.Errorf("Unexpected header warnings: %v", warnings)
+	}
+
+	err := Get("http://example.com").Header("Host", "other").StrictHeaders().Send().Done()
+	if err == nil || !strings.Contains(err.Error(), `header "Host"`) {
+		t.Errorf("Expected strict header error, got %v", err)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, TestString)
+	}))
+	defer ts.Close()
+
+	resp := Post(ts.URL+"/old").BasicAuth("user", "pass").Body(bytes.NewBufferString("payload")).Send()
+	exchange := resp.Exchange()
+	if exchange.RequestHeader.Get("Authorization") != "REDACTED" {
+		t.Errorf("Expected Authorization to be redacted, got %q", exchange.RequestHeader.Get("Authorization"))
+	}
+	if len(exchange.Attempts) != 2 || exchange.Attempts[0].StatusCode != 302 || exchange.StatusCode != 200 {
+		t.Errorf("Unexpected exchange: %+v", exchange)
+	}
+	if exchange.RequestBodySHA256 == "" || exchange.ResponseBodySHA256 == "" {
+		t.Errorf("Expected body hashes: %+v", exchange)
+	}
+
+	var body string
+	if err := resp.GetBody(&body).Done(); err != nil || body != TestString {
+		t.Errorf("Expected body to still be readable, got %q, %v", body, err)
+	}
+}
+
+func TestExpectCacheable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+	}))
+	defer ts.Close()
+
+	if err := Get(ts.URL).QueryParam("cc", "public, max-age=600").Send().ExpectCacheable(5 * time.Minute).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if err := Get(ts.URL).QueryParam("cc", "public, max-age=60").Send().ExpectCacheable(5 * time.Minute).Done(); err == nil {
+		t.Error("Expected max-age to be too short")
+	}
+	if err := Get(ts.URL).QueryParam("cc", "private, max-age=600").Send().ExpectNotCacheable().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if err := Get(ts.URL).QueryParam("cc", "s-maxage=600").Send().ExpectNotCacheable().Done(); err == nil {
+		t.Error("Expected response to be cacheable")
+	}
+}
+
+func TestJSONNaming(t *testing.T) {
+	type user struct {
+		UserID    int
+		FirstName string
+		Nickname  string `json:"nick"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	var body string
+	var out user
+	err := NewClient().JSONNaming(SnakeCase).Post(ts.URL).
+		JSONBody(user{UserID: 7, FirstName: "Ada", Nickname: "a"}).
+		Send().
+		GetBody(&body).
+		GetJSON(&out).
+		Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if body != `{"user_id":7,"first_name":"Ada","nick":"a"}` {
+		t.Errorf("Unexpected body %s", body)
+	}
+	if out.UserID != 7 || out.FirstName != "Ada" || out.Nickname != "a" {
+		t.Errorf("Unexpected decoded value %+v", out)
+	}
+
+	// errors keep their own field names
+	err = NewClient().JSONNaming(SnakeCase).Get(ts.URL).Send().ExpectStatusCode(http.StatusTeapot).Done()
+	if err == nil || !strings.Contains(err.Error(), `"StatusCode"`) || strings.Contains(err.Error(), "status_code") {
+		t.Errorf("Expected the response to be formatted without the naming strategy, got %v", err)
+	}
+
+	for name, want := range map[string]string{"UserID": "user_id", "HTTPServer": "http_server", "Name": "name"} {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if got := camelCase("HTTPServer"); got != "httpServer" {
+		t.Errorf("camelCase(HTTPServer) = %q", got)
+	}
+}
+
+func TestGetJSONEnvelope(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			fmt.Fprint(w, `{"code": 1002, "message": "user not found", "data": null}`)
+			return
+		}
+		fmt.Fprint(w, `{"code": 0, "message": "ok", "data": {"name": "Ada", "tags": ["a"]}}`)
+	}))
+	defer ts.Close()
+
+	var user struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+	if err := Get(ts.URL).Send().GetJSONEnvelope("data", "code", &user).Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if user.Name != "Ada" || len(user.Tags) != 1 {
+		t.Errorf("Unexpected data %+v", user)
+	}
+
+	err := Get(ts.URL).QueryParam("fail", "1").Send().GetJSONEnvelope("data", "code", &user).Done()
+	if err == nil || !strings.Contains(err.Error(), "envelope error code 1002: user not found") {
+		t.Errorf("Expected envelope error, got %v", err)
+	}
+
+	root := jsoniter.Get([]byte(`{"error": {"code": "E1", "message": "bad"}}`))
+	if e := envelopeError(root, "error"); e == nil || e.Code != "E1" || e.Message != "bad" {
+		t.Errorf("Unexpected envelope error %+v", e)
+	}
+}
+
+func TestGetAuto(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Accept") {
+		case "application/xml":
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			fmt.Fprint(w, `<user><name>Ada</name></user>`)
+		case "text/csv":
+			w.Header().Set("Content-Type", "text/csv")
+			fmt.Fprint(w, "name,age\nAda,36\n")
+		default:
+			w.Header().Set("Content-Type", "application/problem+json")
+			fmt.Fprint(w, `{"name": "Ada"}`)
+		}
+	}))
+	defer ts.Close()
+
+	var user struct {
+		Name string `json:"name" xml:"name"`
+	}
+	if err := Get(ts.URL).Send().GetAuto(&user).Done(); err != nil || user.Name != "Ada" {
+		t.Errorf("Unexpected json result %+v, %v", user, err)
+	}
+
+	user.Name = ""
+	if err := NewClient().Accept("application/xml").Get(ts.URL).Send().GetAuto(&user).Done(); err != nil || user.Name != "Ada" {
+		t.Errorf("Unexpected xml result %+v, %v", user, err)
+	}
+
+	var records [][]string
+	if err := Get(ts.URL).Header("Accept", "text/csv").Send().GetAuto(&records).Done(); err != nil || len(records) != 2 {
+		t.Errorf("Unexpected csv result %v, %v", records, err)
+	}
+}
+
+func TestPhaseTimeouts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte(TestString))
+	}))
+	defer ts.Close()
+
+	var body string
+	err := Get(ts.URL).ConnectTimeout(time.Second).ResponseHeaderTimeout(time.Second).Send().GetBody(&body).Done()
+	if err != nil || body != TestString {
+		t.Errorf("Unexpected result %q, %v", body, err)
+	}
+
+	err = Get(ts.URL).QueryParam("slow", "1").ResponseHeaderTimeout(50 * time.Millisecond).Send().Done()
+	if err == nil || !strings.Contains(err.Error(), "response header timed out after 50ms") {
+		t.Errorf("Expected response header timeout, got %v", err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		default:
+			fmt.Fprintf(w, `{"path": %q}`, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	var a, b struct{ Path string }
+	group := Group(context.Background())
+	group.Go(Get(ts.URL+"/a"), &a)
+	group.Go(Get(ts.URL+"/b"), &b)
+	if err := group.Wait(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if a.Path != "/a" || b.Path != "/b" {
+		t.Errorf("Unexpected results %q, %q", a.Path, b.Path)
+	}
+
+	start := time.Now()
+	group = Group(context.Background())
+	group.Go(Get(ts.URL+"/slow"), nil)
+	group.Go(Get(ts.URL+"/fail"), nil)
+	if err := group.Wait(); err == nil {
+		t.Error("Expected group to fail")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Expected the slow request to be cancelled")
+	}
+}
+
+func TestDisableKeepAlive(t *testing.T) {
+	var mu sync.Mutex
+	remotes := map[string]bool{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		remotes[r.RemoteAddr] = true
+		mu.Unlock()
+		w.Header().Set("X-Close", fmt.Sprint(r.Close))
+	}))
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		var closing string
+		if err := Get(ts.URL).DisableKeepAlive().Send().GetHeader("X-Close", &closing).Done(); err != nil {
+			t.Fatal(err.Error())
+		}
+		if closing != "true" {
+			t.Error("Expected Connection: close to be sent")
+		}
+	}
+	if len(remotes) != 3 {
+		t.Errorf("Expected a new connection per request, got %d", len(remotes))
+	}
+
+	// the copy without keep-alives belongs to the client and is dropped with its transport
+	client := NewClient()
+	for i := 0; i < 2; i++ {
+		if err := client.Get(ts.URL).DisableKeepAlive().Send().ExpectSuccess().Done(); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if len(client.derived.transports) != 1 {
+		t.Errorf("Expected one transport without keep-alives, got %d", len(client.derived.transports))
+	}
+	client.Transport(&http.Transport{})
+	if len(client.derived.transports) != 0 {
+		t.Errorf("Expected copies of the old transport to be dropped, got %d", len(client.derived.transports))
+	}
+
+	var closing string
+	Get(ts.URL).CloseConnection().Send().GetHeader("X-Close", &closing)
+	if closing != "true" {
+		t.Error("Expected Connection: close to be sent")
+	}
+}
+
+func TestMultipartSizeAndBoundary(t *testing.T) {
+	var contentType string
+	var length int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		length = r.ContentLength
+	}))
+	defer ts.Close()
+
+	form := questmultipart.New(questmultipart.Boundary("quest-boundary")).AddField("name", "Ada")
+	size := form.Size()
+	if err := Post(ts.URL).MultipartBody(form.Close()).Send().Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if contentType != "multipart/form-data; boundary=quest-boundary" {
+		t.Errorf("Unexpected Content-Type %q", contentType)
+	}
+	if length != size || form.Size() != size {
+		t.Errorf("Expected Content-Length %d, got %d", size, length)
+	}
+}
+
+func TestJSONBodyReader(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	var body string
+	raw := `{"name": "Ada"}`
+	err := Post(ts.URL).JSONBodyReader(strings.NewReader(raw)).ValidateJSONBody().Send().ExpectType("json").GetBody(&body).Done()
+	if err != nil || body != raw {
+		t.Errorf("Unexpected result %q, %v", body, err)
+	}
+
+	err = Post(ts.URL).JSONBodyReader(strings.NewReader(`{"name": `)).ValidateJSONBody().Send().Done()
+	if err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("Expected invalid JSON error, got %v", err)
+	}
+	if hits != 1 {
+		t.Errorf("Expected invalid body not to be sent, got %d requests", hits)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	hits := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+			fmt.Fprint(w, TestString)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	metrics := map[string]int{}
+	now := time.Now()
+	client := NewClient().WithClock(fixedClock(now)).Cache(0).NegativeCache(time.Second).WithMetrics(func(m Metric) {
+		metrics[m.Name]++
+	})
+
+	for i := 0; i < 3; i++ {
+		var body string
+		resp := client.Get(ts.URL + "/fresh").Send()
+		if err := resp.GetBody(&body).Done(); err != nil || body != TestString {
+			t.Errorf("Unexpected result %q, %v", body, err)
+		}
+		if resp.FromCache() != (i > 0) {
+			t.Errorf("Unexpected FromCache %v for request %d", resp.FromCache(), i)
+		}
+		client.Get(ts.URL + "/missing").Send().ExpectStatusCode(404)
+		client.Get(ts.URL + "/gone").Send().ExpectStatusCode(410)
+	}
+	if hits["/fresh"] != 1 || hits["/missing"] != 1 || hits["/gone"] != 1 {
+		t.Errorf("Expected one upstream request per path, got %v", hits)
+	}
+	if metrics[MetricCacheHits] != 2 || metrics[MetricNegativeCacheHits] != 4 || metrics[MetricCacheMisses] != 3 {
+		t.Errorf("Unexpected cache metrics %v", metrics)
+	}
+
+	client.WithClock(fixedClock(now.Add(2 * time.Second)))
+	client.Get(ts.URL + "/missing").Send()
+	client.Get(ts.URL + "/fresh").Send()
+	if hits["/missing"] != 2 || hits["/fresh"] != 1 {
+		t.Errorf("Expected only the negative entry to expire, got %v", hits)
+	}
+}
+
+func TestParallelSteps(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `{"path": %q}`, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	var user, perms struct{ Path string }
+	var last string
+	err := Get(ts.URL+"/session").Send().ExpectSuccess().Next().
+		Parallel(
+			func(n *Next) *Response {
+				return n.Get(ts.URL + "/user").StepName("user").Send().GetJSON(&user)
+			},
+			func(n *Next) *Response {
+				return n.Get(ts.URL + "/permissions").StepName("permissions").Send().GetJSON(&perms)
+			},
+		).
+		Get(ts.URL + "/dashboard").Send().GetBody(&last).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if user.Path != "/user" || perms.Path != "/permissions" || !strings.Contains(last, "/dashboard") {
+		t.Errorf("Unexpected results %q, %q, %q", user.Path, perms.Path, last)
+	}
+
+	var siblingClosed int32
+	siblingDone := make(chan struct{})
+	trackClose := func(next Handler) Handler {
+		return func(r *Request) *Response {
+			resp := next(r)
+			if resp.Response != nil && resp.Response.Body != nil {
+				resp.Response.Body = closeFunc{resp.Response.Body, func() { atomic.StoreInt32(&siblingClosed, 1) }}
+			}
+			return resp
+		}
+	}
+	err = Get(ts.URL+"/session").Send().Next().
+		Parallel(
+			func(n *Next) *Response {
+				defer close(siblingDone)
+				return n.Get(ts.URL + "/user").Use(trackClose).Send().ExpectSuccess()
+			},
+			func(n *Next) *Response {
+				<-siblingDone
+				return n.Get(ts.URL + "/fail").StepName("fail").Send().ExpectSuccess()
+			},
+		).
+		Get(ts.URL + "/dashboard").Send().Done()
+	var chainErr *ChainError
+	if !errors.As(err, &chainErr) || chainErr.Step.Name != "fail" || len(chainErr.Completed) != 1 {
+		t.Errorf("Expected the failed parallel step in a ChainError, got %v", err)
+	}
+	if atomic.LoadInt32(&siblingClosed) != 1 {
+		t.Error("Expected the successful sibling's body to be closed")
+	}
+}
+
+// closeFunc calls onClose when the body is closed
+type closeFunc struct {
+	io.ReadCloser
+	onClose func()
+}
+
+func (c closeFunc) Close() error {
+	c.onClose()
+	return c.ReadCloser.Close()
+}
+
+func TestDryRun(t *testing.T) {
+	client := NewClient().ScopedBearer("api.example.com", "secret")
+	snapshot, err := client.Post("https://api.example.com/users/:id").
+		Param("id", "42").
+		BasicAuth("ignored", "ignored").
+		Header("Authorization", "Bearer override").
+		JSONBody(map[string]string{"name": "Ada"}).
+		DryRun()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if snapshot.Method != http.MethodPost || snapshot.URL != "https://api.example.com/users/42" {
+		t.Errorf("Unexpected request line %s %s", snapshot.Method, snapshot.URL)
+	}
+	if snapshot.Header.Get("Authorization") != "Bearer override" || snapshot.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected headers %v", snapshot.Header)
+	}
+	if string(snapshot.Body) != `{"name":"Ada"}` || snapshot.ContentLength != int64(len(snapshot.Body)) {
+		t.Errorf("Unexpected body %q (%d)", snapshot.Body, snapshot.ContentLength)
+	}
+
+	if _, err := Get("http://example.com").RequireTLS().DryRun(); err == nil {
+		t.Error("Expected DryRun to apply the TLS policy")
+	}
+}
+
+func TestGetJSONNotJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, "<html>\n  <body>502 Bad Gateway</body>\n</html>")
+	}))
+	defer ts.Close()
+
+	var out map[string]interface{}
+	err := Get(ts.URL).Send().GetJSON(&out).Done()
+	if err == nil || !strings.Contains(err.Error(), `Expected JSON, got "text/html" with status '502': "<html> <body>502 Bad Gateway</body> </html>"`) {
+		t.Errorf("Expected a descriptive error, got %v", err)
+	}
+
+	resp := &Response{Response: &http.Response{StatusCode: 503, Header: http.Header{}}}
+	if err := resp.notJSON([]byte("Service Unavailable")); err == nil {
+		t.Error("Expected plaintext to be detected")
+	}
+	if err := resp.notJSON([]byte(` [1, 2]`)); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestOperationName(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	var operations []string
+	client := NewClient().WithMetrics(func(m Metric) {
+		if m.Name == MetricResponseBytes {
+			operations = append(operations, m.Labels["operation"])
+		}
+	})
+	ctx := context.Background()
+	client.Get(ts.URL+"/users/:id").Param("id", "42").WithContext(ctx).Send().ExpectNoBody()
+	client.Get(ts.URL+"/users/:id").Param("id", "43").OperationName("lookup user").WithContext(ctx).Send().ExpectNoBody()
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 || spans[0].OperationName != "GET /users/:id" || spans[1].OperationName != "lookup user" {
+		t.Fatalf("Unexpected spans %v", spans)
+	}
+	if spans[0].Tag("http.route") != "/users/:id" {
+		t.Errorf("Unexpected route tag %v", spans[0].Tag("http.route"))
+	}
+	if len(operations) != 2 || operations[0] != "GET /users/:id" || operations[1] != "lookup user" {
+		t.Errorf("Unexpected metric operations %v", operations)
+	}
+}
+
+func TestLimiterPriority(t *testing.T) {
+	l := &limiter{max: 1}
+	l.acquire(context.Background(), systemClock{}, PriorityNormal)
+
+	served := make(chan Priority, 100)
+	enqueue := func(p Priority) {
+		_, queued := l.counts()
+		go func() {
+			l.acquire(context.Background(), systemClock{}, p)
+			served <- p
+		}()
+		for {
+			if _, n := l.counts(); n > queued {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	enqueue(PriorityLow)
+	enqueue(PriorityHigh)
+	l.release()
+	if p := <-served; p != PriorityHigh {
+		t.Fatalf("Expected the high priority request first, got %d", p)
+	}
+
+	// keep a high priority request queued so the low one can only win by aging
+	highs := 0
+	for {
+		enqueue(PriorityHigh)
+		l.release()
+		if p := <-served; p == PriorityLow {
+			break
+		}
+		highs++
+		if highs > 3*agingSteps {
+			t.Fatal("Expected the low priority request not to starve")
+		}
+	}
+	l.release()
+	<-served
+}
+
+func TestWithClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.Header().Set("X-Via", r.Header.Get("X-Via"))
+	}))
+	defer ts.Close()
+
+	var redirects int
+	client := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Via", "shared")
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			redirects++
+			return nil
+		},
+	}
+
+	var via string
+	if err := Get(ts.URL+"/redirect").WithClient(client).Send().ExpectSuccess().GetHeader("X-Via", &via).Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if via != "shared" || redirects != 1 {
+		t.Errorf("Expected the injected client to be used, got %q and %d redirects", via, redirects)
+	}
+
+	SetDefaultClient(client)
+	defer SetDefaultClient(nil)
+	via = ""
+	Get(ts.URL).Send().GetHeader("X-Via", &via)
+	if via != "shared" {
+		t.Error("Expected the default client to be used")
+	}
+	if _, ok := client.Transport.(roundTripFunc); !ok {
+		t.Error("Expected the injected client not to be modified")
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestExpectHeaderValues(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "session=abc; HttpOnly")
+		w.Header().Add("Set-Cookie", "theme=dark")
+	}))
+	defer ts.Close()
+
+	err := Get(ts.URL).Send().
+		ExpectHeaderCount("Set-Cookie", 2).
+		ExpectHeaderValues("Set-Cookie", HeaderEquals("theme=dark"), HeaderPrefix("session="), HeaderContains("HttpOnly")).
+		Done()
+	if err == nil || !strings.Contains(err.Error(), `Expected a "Set-Cookie" header value containing "HttpOnly"`) {
+		t.Errorf("Expected HttpOnly to need a third value, got %v", err)
+	}
+
+	err = Get(ts.URL).Send().
+		ExpectHeaderValues("Set-Cookie", HeaderMatches(regexp.MustCompile(`^session=\w+; HttpOnly$`)), HeaderEquals("theme=dark")).
+		Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	// a matcher that could take either value must leave the only one the next needs
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-V", "abc")
+		w.Header().Add("X-V", "a")
+	}))
+	defer ts2.Close()
+	err = Get(ts2.URL).Send().ExpectHeaderValues("X-V", HeaderContains("a"), HeaderEquals("abc")).Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("stall") != "" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	err := Get(ts.URL).Timeout(50 * time.Millisecond).DialTimeout(time.Second).Send().Done()
+	if err == nil || !strings.Contains(err.Error(), "request timed out after 50ms") {
+		t.Errorf("Expected request timeout, got %v", err)
+	}
+
+	var body string
+	err = Get(ts.URL).QueryParam("stall", "1").Timeout(50 * time.Millisecond).Send().ExpectSuccess().GetBody(&body).Done()
+	if err == nil {
+		t.Error("Expected the timeout to cover reading the body")
+	}
+}
+
+func TestRawJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": {"items": [{"type": "card", "payload": {"last4": "4242"}}]}}`)
+	}))
+	defer ts.Close()
+
+	resp := Get(ts.URL).Send()
+	raw, err := resp.RawJSON("data.items.0.payload")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(raw) != `{"last4": "4242"}` {
+		t.Errorf("Unexpected raw json %s", raw)
+	}
+	if raw, err := resp.RawJSON("data.items.0.type"); err != nil || string(raw) != `"card"` {
+		t.Errorf("Unexpected raw json %s, %v", raw, err)
+	}
+	if _, err := resp.RawJSON("data.items.1"); err == nil {
+		t.Error("Expected a missing path to error")
+	}
+	if err := resp.Done(); err != nil {
+		t.Errorf("Expected RawJSON not to fail the response, got %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		n := len(bodies)
+		mu.Unlock()
+		if r.URL.Path == "/down" || n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	resp := Post(ts.URL).JSONBody(map[string]int{"n": 1}).Retry(3).Backoff(ConstantBackoff(time.Millisecond)).Send()
+	if err := resp.ExpectSuccess().Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if resp.Attempts() != 3 || len(bodies) != 3 || bodies[2] != `{"n":1}` {
+		t.Errorf("Expected the body to be replayed on 3 attempts, got %d: %q", resp.Attempts(), bodies)
+	}
+
+	err := Get(ts.URL + "/down").Retry(2).WithClock(fixedClock(time.Now())).Send().ExpectSuccess().Done()
+	if err == nil || !strings.Contains(err.Error(), `"Attempts": 3`) {
+		t.Errorf("Expected the attempt count in the error, got %v", err)
+	}
+
+	backoff := ExponentialBackoff{Initial: time.Second, Max: 5 * time.Second, Jitter: 0.5}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 5 * time.Second} {
+		if got := backoff.Delay(attempt, 0); got != want {
+			t.Errorf("Delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+	if got := backoff.Delay(1, 0.5); got != 750*time.Millisecond {
+		t.Errorf("Expected jitter to shorten the delay, got %s", got)
+	}
+}
+
+func TestGetJSONPolymorphic(t *testing.T) {
+	type card struct{ Last4 string }
+	type bank struct{ IBAN string }
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"method": {"type": %q}, "Last4": "4242", "IBAN": "DE89"}`, r.URL.Query().Get("type"))
+	}))
+	defer ts.Close()
+
+	registry := map[string]func() interface{}{
+		"card": func() interface{} { return &card{} },
+		"bank": func() interface{} { return &bank{} },
+	}
+	var method interface{}
+	if err := Get(ts.URL).QueryParam("type", "bank").Send().GetJSONPolymorphic("method.type", registry, &method).Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if b, ok := method.(*bank); !ok || b.IBAN != "DE89" {
+		t.Errorf("Expected a bank, got %#v", method)
+	}
+
+	err := Get(ts.URL).QueryParam("type", "cash").Send().GetJSONPolymorphic("method.type", registry, &method).Done()
+	if err == nil || !strings.Contains(err.Error(), `Expected "method.type" to be one of ["bank" "card"], got "cash"`) {
+		t.Errorf("Expected an unknown type error, got %v", err)
+	}
+}
+
+func TestMultipartProgress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer ts.Close()
+	data := bytes.Repeat([]byte("x"), 100*1024)
+
+	var progress []int64
+	form := questmultipart.New().
+		AddField("name", "Ada").
+		AddFile("file", "a.txt", bytes.NewReader(data), questmultipart.CopyEncode,
+			questmultipart.Progress(func(written int64) { progress = append(progress, written) })).
+		Close()
+	if len(progress) != 0 {
+		t.Errorf("Expected no progress before the form is sent, got %v", progress)
+	}
+	if err := Post(ts.URL).MultipartBody(form).Send().ExpectSuccess().Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(progress) < 2 || progress[len(progress)-1] != int64(len(data)) {
+		t.Errorf("Unexpected progress %v", progress)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	form = questmultipart.New().AddFile("file", "b.txt", bytes.NewReader(data), questmultipart.CopyEncode,
+		questmultipart.Context(ctx),
+		questmultipart.Progress(func(written int64) { cancel() }))
+	if form.Err != nil {
+		t.Fatal(form.Err)
+	}
+	err := Post(ts.URL).MultipartBody(form).Send().Done()
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("Expected sending the part to be aborted, got %v", err)
+	}
+
+	form = questmultipart.New().AddFile("file", "c.txt", bytes.NewReader(data), questmultipart.CopyEncode,
+		questmultipart.Context(ctx))
+	if !errors.Is(form.Err, context.Canceled) {
+		t.Errorf("Expected encoding the part to be aborted, got %v", form.Err)
+	}
+}
+
+type recordingClock struct {
+	fixedClock
+	mu    sync.Mutex
+	waits []time.Duration
+}
+
+func (c *recordingClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	c.waits = append(c.waits, d)
+	c.mu.Unlock()
+	return c.fixedClock.After(d)
+}
+
+func TestRetryAfter(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer ts.Close()
+
+	clock := &recordingClock{fixedClock: fixedClock(time.Now())}
+	resp := Get(ts.URL).Retry(1).WithClock(clock).Send()
+	if err := resp.ExpectSuccess().Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(clock.waits) != 1 || clock.waits[0] != 7*time.Second {
+		t.Errorf("Expected to wait for Retry-After, got %v", clock.waits)
+	}
+
+	hits = 0
+	resp = Get(ts.URL).Retry(1).MaxRetryAfter(time.Second).Send()
+	if d, ok := resp.RetryAfter(); resp.StatusCode != http.StatusTooManyRequests || !ok || d != 7*time.Second {
+		t.Errorf("Expected the 429 to be returned, got %d with Retry-After %s", resp.StatusCode, d)
+	}
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if d, ok := parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now); !ok || d != 90*time.Second {
+		t.Errorf("Unexpected http date Retry-After %s", d)
+	}
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	clock = &recordingClock{fixedClock: fixedClock(time.Now())}
+	resp = Post(unavailable.URL).Retry(1).WithClock(clock).Send()
+	if resp.StatusCode != http.StatusServiceUnavailable || len(clock.waits) != 0 {
+		t.Errorf("Expected a long Retry-After not to be waited for by default, got %d after %v", resp.StatusCode, clock.waits)
+	}
+	Post(unavailable.URL).Retry(1).MaxRetryAfter(-1).WithClock(clock).Send()
+	if len(clock.waits) != 1 || clock.waits[0] != time.Hour {
+		t.Errorf("Expected a negative MaxRetryAfter to remove the limit, got %v", clock.waits)
+	}
+}
+
+func TestRetryPermanentErrors(t *testing.T) {
+	secure := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	var handshakes int32
+	secure.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&handshakes, 1)
+		}
+	}
+	secure.StartTLS()
+	defer secure.Close()
+	err := Get(secure.URL).Retry(3).WithClock(fixedClock(time.Now())).Send().Done()
+	if err == nil || atomic.LoadInt32(&handshakes) != 1 {
+		t.Errorf("Expected an untrusted certificate not to be retried, got %d connections and %v", handshakes, err)
+	}
+
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.Redirect(w, r, "http://blocked.example.com/", http.StatusFound)
+	}))
+	defer ts.Close()
+	err = NewClient().AllowHosts("127.0.0.1").Get(ts.URL).Retry(3).WithClock(fixedClock(time.Now())).Send().Done()
+	if !errors.Is(err, ErrHostNotAllowed) || atomic.LoadInt32(&hits) != 1 {
+		t.Errorf("Expected a blocked redirect not to be retried, got %d requests and %v", hits, err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	hits, healthy := 0, false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	var states []float64
+	now := time.Now()
+	client := NewClient().WithClock(fixedClock(now)).
+		WithBreaker("127.0.0.1", BreakerSettings{Failures: 2, Cooldown: time.Minute}).
+		WithMetrics(func(m Metric) {
+			if m.Name == MetricBreakerOpen {
+				states = append(states, m.Value)
+			}
+		})
+
+	client.Get(ts.URL).Send()
+	client.Get(ts.URL).Send()
+	err := client.Get(ts.URL).Send().Done()
+	if err == nil || !strings.Contains(err.Error(), "circuit breaker for "+strings.TrimPrefix(ts.URL, "http://")+" is open") {
+		t.Errorf("Expected the breaker to be open, got %v", err)
+	}
+	if hits != 2 {
+		t.Errorf("Expected the open breaker to fail fast, got %d requests", hits)
+	}
+
+	healthy = true
+	client.WithClock(fixedClock(now.Add(2 * time.Minute)))
+	if err := client.Get(ts.URL).Send().ExpectSuccess().Done(); err != nil {
+		t.Errorf("Expected the trial request to go through, got %v", err)
+	}
+	if err := client.Get(ts.URL).Send().ExpectSuccess().Done(); err != nil {
+		t.Errorf("Expected the breaker to close, got %v", err)
+	}
+	if len(states) != 2 || states[0] != 1 || states[1] != 0 {
+		t.Errorf("Unexpected breaker metrics %v", states)
+	}
+}
+
+func TestCookies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Secure: true, SameSite: http.SameSiteStrictMode, MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "old", Value: "", MaxAge: -1})
+			return
+		}
+		c, err := r.Cookie("session")
+		if err != nil || c.Value != "abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	var session http.Cookie
+	var value string
+	err := Get(ts.URL+"/login").Send().
+		ExpectCookie("session").
+		GetCookie("session", &session).
+		GetCookieValue("session", &value).
+		Next().
+		Get(ts.URL + "/me").Cookie(&session).Send().ExpectSuccess().
+		Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if value != "abc" || !session.Secure || session.SameSite != http.SameSiteStrictMode || session.MaxAge != 3600 {
+		t.Errorf("Unexpected cookie %+v", session)
+	}
+
+	if err := Get(ts.URL + "/login").Send().ExpectCookie("old").Done(); err == nil {
+		t.Error("Expected a deleted cookie to fail ExpectCookie")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Auth", r.Header.Get("Authorization"))
+	}))
+	defer ts.Close()
+
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(r *Request) *Response {
+				calls = append(calls, name+" before")
+				resp := next(r)
+				calls = append(calls, fmt.Sprintf("%s after %d", name, resp.StatusCode))
+				return resp
+			}
+		}
+	}
+	auth := func(next Handler) Handler {
+		return func(r *Request) *Response {
+			return next(r.Header("Authorization", "Bearer token"))
+		}
+	}
+
+	Use(trace("global"))
+	defer func() { middleware.list = nil }()
+
+	var header string
+	err := Get(ts.URL).Use(auth, trace("request")).Send().GetHeader("X-Auth", &header).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if header != "Bearer token" {
+		t.Errorf("Expected middleware to add auth, got %q", header)
+	}
+	want := []string{"global before", "request before", "request after 200", "global after 200"}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("Unexpected middleware order %v", calls)
+	}
+}
+
+func TestCodecRegistry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	RegisterCodec("text/x-upper", Codec{
+		Encode: func(w io.Writer, value interface{}) error {
+			_, err := io.WriteString(w, strings.ToUpper(value.(string)))
+			return err
+		},
+		Decode: func(body io.Reader, into interface{}) error {
+			b, err := ioutil.ReadAll(body)
+			*into.(*string) = strings.ToLower(string(b))
+			return err
+		},
+	})
+	defer delete(codecs.m, "text/x-upper")
+
+	var raw, decoded string
+	err := Post(ts.URL).BodyAs("text/x-upper", "Hello").Send().GetBody(&raw).GetAuto(&decoded).Done()
+	if err != nil || raw != "HELLO" || decoded != "hello" {
+		t.Errorf("Unexpected result %q, %q, %v", raw, decoded, err)
+	}
+
+	var out struct{ Name string }
+	err = Post(ts.URL).BodyAs("application/vnd.api+json", struct{ Name string }{"Ada"}).Send().GetAuto(&out).Done()
+	if err != nil || out.Name != "Ada" {
+		t.Errorf("Unexpected json result %+v, %v", out, err)
+	}
+
+	if err := Post(ts.URL).BodyAs("application/cbor", 1).Send().Done(); err == nil {
+		t.Error("Expected an unregistered media type to fail")
+	}
+
+	// a JSON codec replaces the default for JSONBody and GetJSON
+	var encoded, decodedJSON int
+	RegisterCodec("application/json", Codec{
+		Encode: func(w io.Writer, value interface{}) error {
+			encoded++
+			return json.NewEncoder(w).Encode(value)
+		},
+		Decode: func(body io.Reader, into interface{}) error {
+			decodedJSON++
+			return json.NewDecoder(body).Decode(into)
+		},
+	})
+	defer delete(codecs.m, "application/json")
+	out.Name = ""
+	err = Post(ts.URL).JSONBody(struct{ Name string }{"Ada"}).Send().GetJSON(&out).Done()
+	if err != nil || out.Name != "Ada" || encoded != 1 || decodedJSON != 1 {
+		t.Errorf("Expected the registered JSON codec to be used, got %+v, %d, %d, %v", out, encoded, decodedJSON, err)
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", r.Header.Get("X-Request-Id"))
+	}))
+	defer ts.Close()
+
+	var seen string
+	var status int
+	err := Get(ts.URL).
+		OnBeforeSend(func(req *http.Request) {
+			req.Header.Set("X-Request-Id", "req-1")
+		}).
+		OnAfterReceive(func(resp *Response) {
+			status = resp.StatusCode
+			seen = resp.Header.Get("X-Request-Id")
+		}).
+		Send().
+		Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if seen != "req-1" || status != http.StatusOK {
+		t.Errorf("Unexpected hook results %q, %d", seen, status)
+	}
+}
+
+func TestErrorTraceIDs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	err := Get(ts.URL).WithContext(context.Background()).Send().ExpectSuccess().Done()
+	spans := tracer.FinishedSpans()
+	if err == nil || len(spans) != 1 {
+		t.Fatalf("Expected an error and one span, got %v and %v", err, spans)
+	}
+	expected := fmt.Sprintf("(trace_id=%d span_id=%d)", spans[0].SpanContext.TraceID, spans[0].SpanContext.SpanID)
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error to contain %q, got %q", expected, err.Error())
+	}
+
+	if err := Get(ts.URL).Send().ExpectSuccess().Done(); strings.Contains(err.Error(), "trace_id") {
+		t.Errorf("Unexpected trace ID without tracing %q", err.Error())
+	}
+}
+
+func TestClientBaseURL(t *testing.T) {
+	var path, auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	var proxied int
+	client := NewClient().
+		BaseURL(ts.URL+"/v1/").
+		Header("Authorization", "Bearer token").
+		Timeout(time.Second).
+		Transport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			proxied++
+			return http.DefaultTransport.RoundTrip(req)
+		}))
+
+	err := client.Get("/users/:id").Param("id", "42").Send().ExpectSuccess().Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if path != "/v1/users/42" || auth != "Bearer token" || proxied != 1 {
+		t.Errorf("Unexpected request %q, %q, %d", path, auth, proxied)
+	}
+
+	if err := NewClient().BaseURL("/relative").Get("/users").Send().Done(); err == nil {
+		t.Error("Expected an error for a relative base url")
+	}
+}
+
+func TestRateLimitStore(t *testing.T) {
+	store := NewMemoryTokenStore()
+	now := time.Now()
+	if d, _ := store.Take(context.Background(), "api", 2, 1, now); d != 0 {
+		t.Fatalf("Expected a token, got wait %s", d)
+	}
+	if d, _ := store.Take(context.Background(), "api", 2, 1, now); d != 500*time.Millisecond {
+		t.Fatalf("Expected to wait 500ms, got %s", d)
+	}
+	if d, _ := store.Take(context.Background(), "api", 2, 1, now.Add(500*time.Millisecond)); d != 0 {
+		t.Fatalf("Expected a refilled token, got wait %s", d)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// two clients sharing a store share the quota
+	shared := NewMemoryTokenStore()
+	a := NewClient().RateLimit(20, 1).RateLimitStore(shared, "partner:")
+	b := NewClient().RateLimit(20, 1).RateLimitStore(shared, "partner:")
+	started := time.Now()
+	a.Get(ts.URL).Send().ExpectSuccess()
+	b.Get(ts.URL).Send().ExpectSuccess()
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected the second client to wait for a token, took %s", elapsed)
+	}
+}
+
+func TestEnableMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	registry := prometheus.NewRegistry()
+	if err := EnableMetrics(registry); err != nil {
+		t.Fatal(err)
+	}
+	defer EnableMetrics(nil)
+	if err := EnableMetrics(registry); err != nil {
+		t.Fatalf("Expected enabling the metrics twice to reuse them, got %v", err)
+	}
+
+	var body string
+	var hooked int
+	NewClient().WithMetrics(func(m Metric) {
+		if m.Name == MetricRequests {
+			hooked++
+		}
+	}).Get(ts.URL).Send().ExpectSuccess().GetBody(&body)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := strings.TrimPrefix(ts.URL, "http://")
+	values := map[string]float64{}
+	for _, family := range families {
+		if family.GetHelp() == "" {
+			t.Errorf("Expected %s to have help text", family.GetName())
+		}
+		for _, metric := range family.GetMetric() {
+			var labels []string
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+			key := family.GetName() + "{" + strings.Join(labels, ",") + "}"
+			switch {
+			case metric.Counter != nil:
+				values[key] = metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				values[key] = metric.GetGauge().GetValue()
+			case metric.Histogram != nil:
+				values[key] = float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	labels := "{host=" + host + ",method=GET,status_class=2xx}"
+	for key, want := range map[string]float64{
+		MetricRequests + labels:        1,
+		MetricRequestDuration + labels: 1,
+		MetricResponseBytes + labels:   1,
+		MetricRequestBytes + labels:    1,
+		MetricInFlight + "{}":          0,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("Expected %s to be %v, got %v in %v", key, want, got, values)
+		}
+	}
+	if hooked != 1 {
+		t.Errorf("Expected the client hook to get the request once, got %d", hooked)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	status := "starting"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status": %q}`, status)
+	}))
+	defer ts.Close()
+
+	var changes []bool
+	checker := HealthCheck(ts.URL, HealthOptions{
+		SuccessThreshold: 2,
+		JSONField:        "status",
+		JSONValue:        "ok",
+		OnChange:         func(s HealthStatus) { changes = append(changes, s.Healthy) },
+	})
+
+	ctx := context.Background()
+	if err := checker.Check(ctx); err == nil || checker.Healthy() {
+		t.Fatalf("Expected the check to fail, got %v", err)
+	}
+	status = "ok"
+	checker.Check(ctx)
+	if checker.Healthy() {
+		t.Fatal("Expected to stay unhealthy until the success threshold")
+	}
+	checker.Check(ctx)
+	if !checker.Healthy() {
+		t.Fatalf("Expected to be healthy, got %v", checker.Status().Err)
+	}
+
+	rec := httptest.NewRecorder()
+	checker.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusOK || len(changes) != 1 || !changes[0] {
+		t.Errorf("Unexpected probe %d and changes %v", rec.Code, changes)
+	}
+}
+
+func TestJSONEncoding(t *testing.T) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer ts.Close()
+
+	value := map[string]string{"b": "<x>", "a": "&"}
+	Post(ts.URL).JSONEncoding(JSONOptions{DisableHTMLEscape: true, SortKeys: true}).JSONBody(value).Send()
+	if body != `{"a":"&","b":"<x>"}` {
+		t.Errorf("Unexpected body %s", body)
+	}
+
+	Post(ts.URL).JSONEncoding(JSONOptions{Indent: "\t", SortKeys: true}).JSONBody(value).Send()
+	if body != "{\n\t\"a\": \"\\u0026\",\n\t\"b\": \"\\u003cx\\u003e\"\n}" {
+		t.Errorf("Unexpected indented body %s", body)
+	}
+}
+
+func TestTimings(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	resp := Get(ts.URL).WithClient(ts.Client()).Send()
+	var body string
+	resp.GetBody(&body)
+	timings := resp.Timings()
+	if timings.Connect <= 0 || timings.TLSHandshake <= 0 || timings.TTFB < 10*time.Millisecond || timings.Total < timings.TTFB {
+		t.Errorf("Unexpected timings %+v", timings)
+	}
+
+	err := resp.ExpectSuccess().Done()
+	if err == nil || !strings.Contains(err.Error(), `"TTFB"`) {
+		t.Errorf("Expected timings in error, got %v", err)
+	}
+}
+
+func TestLimitHeaderSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Stuffed", strings.Repeat("a", 4096))
+		w.Header().Set("X-Hostile", "evil\xff\xfebytes")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer ts.Close()
+
+	if err := Get(ts.URL).LimitHeaderSize(1024).Send().Done(); err == nil || !strings.Contains(err.Error(), "exceeded") {
+		t.Errorf("Expected header size error, got %v", err)
+	}
+
+	// the client's limit does not change the transport it was given
+	transport := &http.Transport{}
+	client := NewClient().Transport(transport).LimitHeaderSize(1024)
+	if err := client.Get(ts.URL).Send().Done(); err == nil || !strings.Contains(err.Error(), "exceeded") {
+		t.Errorf("Expected header size error, got %v", err)
+	}
+	if transport.MaxResponseHeaderBytes != 0 {
+		t.Errorf("Expected the client's transport to be unchanged, got limit %d", transport.MaxResponseHeaderBytes)
+	}
+	if err := client.Get(ts.URL).LimitHeaderSize(8192).Send().Done(); err != nil && strings.Contains(err.Error(), "exceeded") {
+		t.Errorf("Expected the request's limit to override the client's, got %v", err)
+	}
+
+	err := Get(ts.URL).Send().ExpectSuccess().Done()
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if strings.Contains(err.Error(), "\xff") || strings.Contains(err.Error(), strings.Repeat("a", 600)) {
+		t.Errorf("Expected sanitized headers in error, got %q", err.Error())
+	}
+	if !strings.Contains(err.Error(), "(3584 more bytes)") {
+		t.Errorf("Expected truncated header in error, got %q", err.Error())
+	}
+}
+
+func TestDerivedTransportsEvict(t *testing.T) {
+	var d derivedTransports
+	builds := 0
+	get := func(limit int64) *http.Transport {
+		return d.get(derivedKey{maxHeaderBytes: limit}, func() *http.Transport {
+			builds++
+			return &http.Transport{}
+		})
+	}
+	first := get(1)
+	for limit := int64(2); limit <= maxDerivedTransports+4; limit++ {
+		get(limit)
+	}
+	if len(d.transports) != maxDerivedTransports || d.recent.Len() != maxDerivedTransports {
+		t.Errorf("Expected at most %d copies, got %d", maxDerivedTransports, len(d.transports))
+	}
+	builds = 0
+	if get(1) == first || builds != 1 {
+		t.Error("Expected the least recently used copy to be evicted")
+	}
+	get(maxDerivedTransports + 4)
+	if builds != 1 {
+		t.Error("Expected a recently used copy to be kept")
+	}
+}
+
+func TestDebug(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "quest"}`))
+	}))
+	defer ts.Close()
+
+	var out bytes.Buffer
+	var into struct{ Name string }
+	err := Post(ts.URL + "/things").Debug(&out).JSONBody(map[string]int{"n": 1}).Send().GetJSON(&into).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if into.Name != "quest" {
+		t.Errorf("Expected the body to still be readable, got %+v", into)
+	}
+	for _, s := range []string{"POST /things HTTP/1.1", `{"n":1}`, "HTTP/1.1 200 OK", `{"name": "quest"}`} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Expected dump to contain %q, got:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t-session"})
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"token": "s3cr3t-token"}`))
+	}))
+	defer ts.Close()
+
+	RedactHeaders("X-Api-Key")
+	RedactPattern(regexp.MustCompile(`"(?:token|password)":\s*"([^"]*)"`))
+	defer func() {
+		redaction.Lock()
+		delete(redaction.headers, "X-Api-Key")
+		redaction.patterns = nil
+		redaction.Unlock()
+	}()
+
+	var dump bytes.Buffer
+	err := Post(ts.URL).
+		Debug(&dump).
+		Header("Authorization", "Bearer s3cr3t-bearer").
+		Header("X-Api-Key", "s3cr3t-key").
+		JSONBody(map[string]string{"password": "s3cr3t-password"}).
+		Send().
+		ExpectSuccess().
+		Done()
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for name, out := range map[string]string{"error": err.Error(), "dump": dump.String()} {
+		if strings.Contains(out, "s3cr3t") {
+			t.Errorf("Expected secrets to be redacted from %s, got:\n%s", name, out)
+		}
+		if !strings.Contains(out, "REDACTED") {
+			t.Errorf("Expected REDACTED in %s, got:\n%s", name, out)
+		}
+	}
+}
+
+func TestMirror(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer ts.Close()
+
+	var mirrored []string
+	var mu sync.Mutex
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		mirrored = append(mirrored, r.Method+" "+r.URL.RequestURI()+" "+string(b)+" "+r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+
+	client := NewClient().
+		Mirror(strings.Replace(shadow.URL, "127.0.0.1", "localhost", 1)+"/shadow", 1).
+		ScopedBearer("127.0.0.1", "token")
+	var body string
+	err := client.Post(ts.URL + "/users?x=1").Body(bytes.NewBufferString("hello")).Send().ExpectSuccess().GetBody(&body).Done()
+	if err != nil || body != "primary" {
+		t.Fatalf("Unexpected primary response %q, %v", body, err)
+	}
+	client.mirror.requests.wg.Wait()
+
+	if len(mirrored) != 1 || mirrored[0] != "POST /shadow/users?x=1 hello " {
+		t.Errorf("Unexpected mirrored requests %q", mirrored)
+	}
+
+	NewClient().Mirror(shadow.URL, 0).Get(ts.URL).Send()
+	if len(mirrored) != 1 {
+		t.Errorf("Expected no mirrored request with a zero sample rate, got %q", mirrored)
+	}
+
+	// mirrored requests use the client's RoundTripper and are dropped when too many are in flight
+	var shadowed int32
+	release := make(chan struct{})
+	client = NewClient().
+		Mirror("http://shadow.test", 1).
+		Transport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Host == "shadow.test" {
+				atomic.AddInt32(&shadowed, 1)
+				<-release
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}))
+	for i := 0; i < maxMirrored+5; i++ {
+		if err := client.Get("http://primary.test").Send().ExpectSuccess().Done(); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	close(release)
+	client.mirror.requests.wg.Wait()
+	if n := atomic.LoadInt32(&shadowed); n != maxMirrored {
+		t.Errorf("Expected %d mirrored requests, got %d", maxMirrored, n)
+	}
+
+	// a shared reader is not mirrored and nothing is mirrored while the breaker is open
+	var primary []string
+	shadowed = 0
+	client = NewClient().
+		Mirror("http://shadow.test", 1).
+		WithBreaker("primary.test", BreakerSettings{Failures: 1, Cooldown: time.Minute}).
+		Transport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Host == "shadow.test" {
+				atomic.AddInt32(&shadowed, 1)
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+			}
+			b, _ := ioutil.ReadAll(req.Body)
+			primary = append(primary, string(b))
+			return &http.Response{StatusCode: http.StatusInternalServerError, Body: http.NoBody, Request: req}, nil
+		}))
+	client.Post("http://primary.test").JSONBodyReader(strings.NewReader(`{"a":1}`)).Send()
+	client.mirror.requests.wg.Wait()
+	if len(primary) != 1 || primary[0] != `{"a":1}` || atomic.LoadInt32(&shadowed) != 0 {
+		t.Errorf("Expected only the primary to read the body, got %q and %d mirrored", primary, shadowed)
+	}
+	client.Get("http://primary.test").Send()
+	client.mirror.requests.wg.Wait()
+	if len(primary) != 1 || atomic.LoadInt32(&shadowed) != 0 {
+		t.Errorf("Expected the open breaker to stop the mirror, got %d mirrored", shadowed)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Query().Get("star") != "" {
+			w.Header().Set("Vary", "*")
+		} else {
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+	defer ts.Close()
+
+	client := NewClient().Cache(10)
+	get := func(lang string) string {
+		var body string
+		client.Get(ts.URL).Header("Accept-Language", lang).Send().GetBody(&body)
+		return body
+	}
+	if get("en") != "en" || get("de") != "de" || get("en") != "en" || get("de") != "de" {
+		t.Fatal("Expected each language to get its own response")
+	}
+	if hits != 2 {
+		t.Errorf("Expected 2 requests to reach the server, got %d", hits)
+	}
+
+	client.Get(ts.URL).QueryParam("star", "1").Send().ExpectSuccess()
+	client.Get(ts.URL).QueryParam("star", "1").Send().ExpectSuccess()
+	if hits != 4 {
+		t.Errorf("Expected Vary: * not to be cached, got %d hits", hits)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer ts.Close()
+
+	err := Post(ts.URL + "/users").Send().ExpectSuccess().Done()
+	if !errors.Is(err, ErrStatus) {
+		t.Errorf("Expected ErrStatus, got %v", err)
+	}
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) {
+		t.Fatalf("Expected a *ResponseError, got %T", err)
+	}
+	if respErr.StatusCode() != http.StatusConflict || respErr.Method() != "POST" || respErr.URL() != ts.URL+"/users" {
+		t.Errorf("Unexpected error details %d %s %s", respErr.StatusCode(), respErr.Method(), respErr.URL())
+	}
+
+	err = Get("http://127.0.0.1:1").Timeout(time.Second).Send().Done()
+	var reqErr *RequestError
+	var urlErr *url.Error
+	if !errors.As(err, &reqErr) || !errors.As(err, &urlErr) || errors.Is(err, ErrStatus) {
+		t.Errorf("Expected a *RequestError wrapping a *url.Error, got %T: %v", err, err)
+	}
+}
+
+type testAPIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *testAPIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func TestExpectSuccessOr(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"code": "invalid_email", "message": "email is invalid"}`))
+			return
+		}
+		w.Write([]byte(`{"code": "ok"}`))
+	}))
+	defer ts.Close()
+
+	var apiErr testAPIError
+	var ok testAPIError
+	if err := Get(ts.URL).Send().ExpectSuccessOr(&apiErr).GetJSON(&ok).Done(); err != nil || ok.Code != "ok" {
+		t.Fatalf("Unexpected result %+v, %v", ok, err)
+	}
+
+	err := Get(ts.URL).QueryParam("fail", "1").Send().ExpectSuccessOr(&apiErr).GetJSON(&ok).Done()
+	var errResp *ErrorResponse
+	if !errors.As(err, &errResp) || errResp.StatusCode != http.StatusUnprocessableEntity || errResp.Body != &apiErr {
+		t.Fatalf("Expected an *ErrorResponse, got %v", err)
+	}
+	var target *testAPIError
+	if !errors.Is(err, ErrStatus) || !errors.As(err, &target) || target.Code != "invalid_email" {
+		t.Errorf("Expected the decoded error payload, got %+v", target)
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	RecordExchanges(2)
+	defer RecordExchanges(0)
+
+	Get(ts.URL + "/first").Send()
+	Get(ts.URL+"/ok").Header("Authorization", "Bearer secret").Send()
+	Post(ts.URL + "/fail").Send()
+
+	recent := RecentExchanges()
+	if len(recent) != 2 || recent[0].URL != ts.URL+"/fail" || recent[1].URL != ts.URL+"/ok" {
+		t.Fatalf("Unexpected exchanges %+v", recent)
+	}
+	if recent[1].RequestHeader.Get("Authorization") != "REDACTED" {
+		t.Errorf("Expected Authorization to be redacted, got %q", recent[1].RequestHeader.Get("Authorization"))
+	}
+
+	rec := httptest.NewRecorder()
+	DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/quest?status=5xx", nil))
+	var exchanges []Exchange
+	if err := jsoniter.Unmarshal(rec.Body.Bytes(), &exchanges); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(exchanges) != 1 || exchanges[0].Method != "POST" || exchanges[0].StatusCode != http.StatusBadGateway {
+		t.Errorf("Unexpected filtered exchanges %+v", exchanges)
+	}
+}
+
+func TestJSONGeneric(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte(`[{"name": "a"}, {"name": "b"}]`))
+	}))
+	defer ts.Close()
+
+	users, err := JSON[[]struct{ Name string }](Get(ts.URL).Send().ExpectSuccess())
+	if err != nil || len(users) != 2 || users[1].Name != "b" {
+		t.Errorf("Unexpected result %+v, %v", users, err)
+	}
+
+	users, err = JSON[[]struct{ Name string }](Get(ts.URL + "/missing").Send().ExpectSuccess())
+	if err == nil || users != nil {
+		t.Errorf("Expected an error and a zero value, got %+v, %v", users, err)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	var retries int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("retry") == "" {
+			// Expires without a Date header is relative to the client's clock
+			w.Header()["Date"] = nil
+			w.Header().Set("Expires", time.Date(2030, 1, 1, 0, 1, 0, 0, time.UTC).Format(http.TimeFormat))
+			return
+		}
+		if retries++; retries == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	clock := NewFakeClock(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	client := NewClient().Cache(10).WithClock(clock)
+	client.Get(ts.URL).Send().ExpectSuccess()
+	clock.Advance(59 * time.Second)
+	if !client.Get(ts.URL).Send().FromCache() {
+		t.Error("Expected a cache hit before Expires")
+	}
+	clock.Advance(time.Second)
+	if client.Get(ts.URL).Send().FromCache() {
+		t.Error("Expected the cache entry to expire")
+	}
+
+	done := make(chan *Response)
+	go func() { done <- client.Get(ts.URL).QueryParam("retry", "1").Retry(1).Send() }()
+	for {
+		clock.mu.Lock()
+		waiting := len(clock.waiters)
+		clock.mu.Unlock()
+		if waiting > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(30 * time.Second)
+	if resp := <-done; resp.Attempts() != 2 || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the retry to wait for the fake clock, got %d attempts", resp.Attempts())
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("slow") {
+		case "release":
+			<-release
+		case "forever":
+			<-r.Context().Done()
+		}
+		w.Write([]byte("done"))
+	}))
+	defer ts.Close()
+
+	client := NewClient()
+	started := make(chan struct{})
+	result := make(chan error)
+	go func() {
+		close(started)
+		var body string
+		result <- client.Get(ts.URL).QueryParam("slow", "release").Send().GetBody(&body).Done()
+	}()
+	<-started
+	for client.inFlightCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// drains the request in flight
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatalf("Expected a clean close, got %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Expected the in-flight request to finish, got %v", err)
+	}
+	if err := client.Get(ts.URL).Send().Done(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Expected ErrClientClosed, got %v", err)
+	}
+
+	// cancels stragglers
+	client = NewClient()
+	go func() { result <- client.Get(ts.URL).QueryParam("slow", "forever").Send().Done() }()
+	for client.inFlightCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the straggler to be canceled, got %v", err)
+	}
+
+	// cancels mirrored requests and drops the client's transport copies
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer shadow.Close()
+	client = NewClient().Mirror(shadow.URL, 1)
+	if err := client.Get(ts.URL).DisableKeepAlive().Send().ExpectSuccess().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if n := len(client.mirror.requests.finish); n != 0 {
+		t.Errorf("Expected mirrored requests to be canceled, got %d", n)
+	}
+	if n := len(client.derived.transports); n != 0 {
+		t.Errorf("Expected transport copies to be closed, got %d", n)
+	}
+}
+
+func TestRegisterTypeAlias(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+	}))
+	defer ts.Close()
+
+	if err := Get(ts.URL).QueryParam("type", "application/vnd.api+json").Send().ExpectType("jsonapi").Done(); err != nil {
+		t.Error(err.Error())
+	}
+
+	RegisterTypeAlias("orders", "application/vnd.acme.orders+json")
+	defer func() {
+		typeAliases.Lock()
+		delete(typeAliases.types, "orders")
+		typeAliases.Unlock()
+	}()
+	if err := Get(ts.URL).QueryParam("type", "application/vnd.acme.orders+json; version=2").Send().ExpectType("orders").Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if err := Get(ts.URL).QueryParam("type", "application/json").Send().ExpectType("orders").Done(); err == nil {
+		t.Error("Expected a mismatched type to fail")
+	}
+}
+
+func TestXMLBody(t *testing.T) {
+	type item struct {
+		XMLName xml.Name `xml:"item"`
+		Name    string   `xml:"name"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte("<item><name>"))
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/xml" {
+			t.Errorf("Expected Content-Type application/xml, got %q", ct)
+		}
+		var in item
+		if err := xml.NewDecoder(r.Body).Decode(&in); err != nil {
+			t.Error(err.Error())
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		xml.NewEncoder(w).Encode(item{Name: in.Name + "!"})
+	}))
+	defer ts.Close()
+
+	var out item
+	err := Post(ts.URL).XMLBody(item{Name: "quest"}).Send().ExpectSuccess().GetXML(&out).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if out.Name != "quest!" {
+		t.Errorf("Expected name %q, got %q", "quest!", out.Name)
+	}
+
+	if err := Get(ts.URL).Send().GetXML(&out).Done(); err == nil {
+		t.Error("Expected malformed xml to fail")
+	}
+}
+
+func TestResponseBuffer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"quest"}`))
+	}))
+	defer ts.Close()
+
+	var streamed bytes.Buffer
+	var body string
+	var value struct{ Name string }
+	err := Get(ts.URL).Send().Buffer().
+		ProxyContext(context.Background(), &streamed).
+		GetJSON(&value).
+		GetBody(&body).
+		Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if streamed.String() != `{"name":"quest"}` || body != streamed.String() {
+		t.Errorf("Expected every read to see the whole body, got %q and %q", streamed.String(), body)
+	}
+	if value.Name != "quest" {
+		t.Errorf("Expected name %q, got %q", "quest", value.Name)
+	}
+}
+
+func TestYAMLBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/yaml" {
+			t.Errorf("Expected Content-Type application/yaml, got %q", ct)
+		}
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	if err := Post(ts.URL).YAMLBody(map[string]string{"a": "b"}).Send().Done(); err == nil {
+		t.Error("Expected an error without a registered yaml codec")
+	}
+
+	// a tiny stand-in for a real YAML library that handles flat string maps
+	RegisterCodec("application/yaml", Codec{
+		Encode: func(w io.Writer, v interface{}) error {
+			for key, value := range v.(map[string]string) {
+				fmt.Fprintf(w, "%s: %s\n", key, value)
+			}
+			return nil
+		},
+		Decode: func(body io.Reader, v interface{}) error {
+			scanner := bufio.NewScanner(body)
+			for scanner.Scan() {
+				parts := strings.SplitN(scanner.Text(), ": ", 2)
+				(*v.(*map[string]string))[parts[0]] = parts[1]
+			}
+			return scanner.Err()
+		},
+	})
+	defer func() {
+		codecs.Lock()
+		delete(codecs.m, "application/yaml")
+		codecs.Unlock()
+	}()
+
+	out := map[string]string{}
+	err := Post(ts.URL).YAMLBody(map[string]string{"kind": "Pod"}).Send().GetYAML(&out).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if out["kind"] != "Pod" {
+		t.Errorf("Expected kind %q, got %q", "Pod", out["kind"])
+	}
+}
+
+func TestTimeoutPhase(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("stall") != "" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := Get(ts.URL).WithContext(ctx).Send().Done()
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != PhaseResponseHeader {
+		t.Fatalf("Expected a timeout waiting for the response headers, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "while waiting for the response headers") {
+		t.Errorf("Expected the phase in the error message, got %v", err)
+	}
+
+	var body string
+	err = Get(ts.URL).QueryParam("stall", "1").Timeout(50 * time.Millisecond).Send().GetBody(&body).Done()
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != PhaseResponseBody {
+		t.Fatalf("Expected a timeout reading the response body, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "request timed out after 50ms while reading the response body") {
+		t.Errorf("Expected the phase in the error message, got %v", err)
+	}
+}
+
+func TestURLChecks(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer ts.Close()
+
+	c := NewClient().MaxURLLength(len(ts.URL) + 20).ValidateURL(func(u *url.URL, template string) error {
+		if strings.Contains(template, "?") {
+			return errors.New("path templates must not contain a query string")
+		}
+		return nil
+	})
+
+	if err := c.Get(ts.URL+"/users/:id").Param("id", "1").Send().Done(); err != nil {
+		t.Error(err.Error())
+	}
+
+	err := c.Get(ts.URL+"/users").QueryParam("filter", strings.Repeat("x", 30)).Send().Done()
+	if !errors.Is(err, ErrURLTooLong) {
+		t.Errorf("Expected ErrURLTooLong, got %v", err)
+	}
+
+	err = c.Get(ts.URL+"/users/:id?expand=1").Param("id", "1").Send().Done()
+	if err == nil || !strings.Contains(err.Error(), "invalid url: path templates must not contain a query string") {
+		t.Errorf("Expected the validator to reject the url, got %v", err)
+	}
+
+	if err := c.Get(ts.URL+"/users").QueryParam("filter", strings.Repeat("x", 30)).MaxURLLength(200).Send().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if hits != 2 {
+		t.Errorf("Expected rejected urls not to be sent, got %d requests", hits)
+	}
+}
+
+func TestMsgpackBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/msgpack" {
+			t.Errorf("Expected Content-Type application/msgpack, got %q", ct)
+		}
+		w.Header().Set("Content-Type", "application/msgpack")
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	// gob stands in for a MessagePack library
+	RegisterCodec("application/msgpack", Codec{
+		Encode: func(w io.Writer, v interface{}) error { return gob.NewEncoder(w).Encode(v) },
+		Decode: func(body io.Reader, v interface{}) error { return gob.NewDecoder(body).Decode(v) },
+	})
+	defer func() {
+		codecs.Lock()
+		delete(codecs.m, "application/msgpack")
+		codecs.Unlock()
+	}()
+
+	type point struct{ X, Y int }
+	var out point
+	err := Post(ts.URL).MsgpackBody(point{1, 2}).Send().ExpectType("msgpack").GetMsgpack(&out).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if out != (point{1, 2}) {
+		t.Errorf("Expected %v, got %v", point{1, 2}, out)
+	}
+}
+
+func TestFormEncoding(t *testing.T) {
+	query := func(r *Request) string {
+		return r.QueryParam("tag", "a b").QueryParam("tag", "c").QueryParam("q", "x").URL.RawQuery
+	}
+
+	if got := query(Get("/search")); got != "q=x&tag=a+b&tag=c" {
+		t.Errorf("Expected the default encoding to be unchanged, got %q", got)
+	}
+	if got := query(Get("/search?page=2").FormEncoding(FormOptions{SpaceAsPercent: true, Arrays: ArrayBrackets})); got != "page=2&tag[]=a%20b&tag[]=c&q=x" {
+		t.Errorf("Expected brackets, got %q", got)
+	}
+	c := NewClient().FormEncoding(FormOptions{Arrays: ArrayComma})
+	if got := query(c.Get("/search")); got != "tag=a+b,c&q=x" {
+		t.Errorf("Expected comma separated values, got %q", got)
+	}
+
+	nested := []formParam{{"user", map[string]interface{}{"name": "quest", "roles": []string{"admin"}}}}
+	if got := encodeForm(nested, FormOptions{Arrays: ArrayBrackets}); got != "user[name]=quest&user[roles][]=admin" {
+		t.Errorf("Expected nested brackets, got %q", got)
+	}
+	if got := encodeForm(nested, FormOptions{Nested: NestedDots}); got != "user.name=quest&user.roles=admin" {
+		t.Errorf("Expected nested dots, got %q", got)
+	}
+}
+
+func TestGetCSV(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		if r.URL.Query().Get("bad") != "" {
+			fmt.Fprint(w, "id,name\nabc,quest\n")
+			return
+		}
+		fmt.Fprint(w, "\ufeffID,Display Name,active,ignored\n1,quest,true,x\n2,\"a, b\",,y\n")
+	}))
+	defer ts.Close()
+
+	var records [][]string
+	if err := Get(ts.URL).Send().GetCSV(&records).Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(records) != 3 || records[2][1] != "a, b" {
+		t.Errorf("Expected 3 records, got %q", records)
+	}
+
+	type row struct {
+		ID     int
+		Name   string `csv:"display name"`
+		Active bool
+	}
+	var rows []row
+	if err := Get(ts.URL).Send().GetCSVRecords(&rows).Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []row{{1, "quest", true}, {2, "a, b", false}}
+	if len(rows) != 2 || rows[0] != expected[0] || rows[1] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected, rows)
+	}
+
+	err := Get(ts.URL).QueryParam("bad", "1").Send().GetCSVRecords(&rows).Done()
+	if err == nil || !strings.Contains(err.Error(), `Invalid CSV. Expected column "id" of record 1 to be a int, got "abc"`) {
+		t.Errorf("Expected an invalid csv error, got %v", err)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	var methods, keys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != `{"name":"quest"}` {
+			t.Errorf("Expected the body to be sent with every method, got %q", body)
+		}
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer ts.Close()
+
+	value := map[string]string{"name": "quest"}
+	if err := Upsert(ts.URL+"/existing", value).Send().ExpectStatusCode(http.StatusOK).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if err := Upsert(ts.URL+"/missing", value).Header("idempotency-key", "abc").Send().ExpectStatusCode(http.StatusCreated).Done(); err != nil {
+		t.Error(err.Error())
+	}
+	expected := []string{http.MethodPut, http.MethodPut, http.MethodPost}
+	if strings.Join(methods, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected methods %v, got %v", expected, methods)
+	}
+	if keys[2] != "abc-post" {
+		t.Errorf("Expected the fallback to derive its idempotency key, got %q", keys[2])
+	}
+
+	methods, keys = nil, nil
+	err := NewClient().Post(ts.URL+"/missing").JSONBody(value).Fallback(http.MethodPut, http.StatusCreated).Send().ExpectStatusCode(http.StatusNotFound).Done()
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if strings.Join(methods, ",") != "POST,PUT" || keys[1] != "" {
+		t.Errorf("Expected an idempotent fallback without a key, got %v %q", methods, keys)
+	}
+}
+
+func TestFormBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+			t.Errorf("Expected a form content type, got %q", ct)
+		}
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	var body string
+	err := Post(ts.URL).
+		FormField("grant_type", "client_credentials").
+		FormField("scope", "read write").
+		Send().GetBody(&body).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if body != "grant_type=client_credentials&scope=read+write" {
+		t.Errorf("Expected encoded fields, got %q", body)
+	}
+
+	values := url.Values{"b": {"2"}, "a": {"1", "x y"}}
+	err = Post(ts.URL).FormEncoding(FormOptions{SpaceAsPercent: true, Arrays: ArrayBrackets}).
+		FormBody(values).FormField("a", "3").
+		Send().GetBody(&body).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if body != "a[]=1&a[]=x%20y&a[]=3&b=2" {
+		t.Errorf("Expected encoded values, got %q", body)
+	}
+}
+
+func TestRetryDNS(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	newClient := func(dials *int, metrics *[]Metric) *Client {
+		var dialer net.Dialer
+		return NewClient().
+			WithMetrics(func(m Metric) { *metrics = append(*metrics, m) }).
+			DialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+				*dials++
+				if host, _, _ := net.SplitHostPort(address); host == "localhost" {
+					// a negative answer cached by the operating system
+					return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+				}
+				return dialer.DialContext(ctx, network, address)
+			})
+	}
+
+	var dials int
+	var metrics []Metric
+	err := newClient(&dials, &metrics).Get("http://localhost:" + port).Retry(2).Backoff(ConstantBackoff(time.Millisecond)).Send().Done()
+	if err == nil || dials != 1 {
+		t.Errorf("Expected a host that was not found to fail without retries, got %d dials: %v", dials, err)
+	}
+	var dnsErrors int
+	for _, m := range metrics {
+		if m.Name == MetricDNSErrors && m.Labels["kind"] == "not_found" {
+			dnsErrors++
+		}
+		if m.Name == MetricRequests && m.Labels["status_class"] != "dns_error" {
+			t.Errorf("Expected status class dns_error, got %q", m.Labels["status_class"])
+		}
+	}
+	if dnsErrors != 1 {
+		t.Errorf("Expected 1 dns error metric, got %d", dnsErrors)
+	}
+
+	dials, metrics = 0, nil
+	if err := newClient(&dials, &metrics).RetryDNS(true).Get("http://localhost:" + port).Send().ExpectSuccess().Done(); err != nil {
+		t.Error(err.Error())
+	}
+	if dials < 2 {
+		t.Errorf("Expected the host to be looked up again, got %d dials", dials)
+	}
+}
+
+func TestDialFailover(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	var dialed []string
+	var dialer net.Dialer
+	client := NewClient().
+		Resolver(fakeResolver(t, "10.0.0.1", "10.0.0.2")).
+		DialFailover(time.Second, false).
+		DialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = append(dialed, address)
+			if len(dialed) == 1 {
+				return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+			}
+			return dialer.DialContext(ctx, network, ts.Listener.Addr().String())
+		})
+	if err := client.Get("http://failover.test:" + port).Send().ExpectSuccess().Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(dialed) != 2 || dialed[0] == dialed[1] {
+		t.Errorf("Expected both addresses to be dialed, got %v", dialed)
+	}
+	for _, address := range dialed {
+		if host, _, _ := net.SplitHostPort(address); host != "10.0.0.1" && host != "10.0.0.2" {
+			t.Errorf("Expected a resolved address to be dialed, got %s", address)
+		}
+	}
+}
+
+// fakeResolver returns a resolver that answers every A query with ips
+func fakeResolver(t *testing.T, ips ...string) *net.Resolver {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// the question ends after its name and 4 bytes of type and class
+			end := 12
+			for end < n && buf[end] != 0 {
+				end += int(buf[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			qtype := binary.BigEndian.Uint16(buf[end-4:])
+
+			resp := append([]byte(nil), buf[:end]...)
+			binary.BigEndian.PutUint16(resp[2:], 0x8180) // response, no error
+			binary.BigEndian.PutUint16(resp[10:], 0)     // no additional records
+			var answers uint16
+			if qtype == 1 {
+				for _, ip := range ips {
+					resp = append(resp, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+					resp = append(resp, net.ParseIP(ip).To4()...)
+					answers++
+				}
+			}
+			binary.BigEndian.PutUint16(resp[6:], answers)
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+func TestQueryStruct(t *testing.T) {
+	type page struct {
+		Page     int `url:"page"`
+		PageSize int `url:"page_size,omitempty"`
+	}
+	type filter struct {
+		page
+		Status  []string          `url:"status"`
+		Owner   *string           `url:"owner"`
+		Since   time.Time         `url:"since,omitempty"`
+		Labels  map[string]string `url:"labels"`
+		Secret  string            `url:"-"`
+		private string
+	}
+	since := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := filter{page: page{Page: 2}, Status: []string{"open", "closed"}, Since: since, Labels: map[string]string{"team": "core"}, Secret: "x", private: "y"}
+
+	r := Get("/issues?sort=asc").FormEncoding(FormOptions{Arrays: ArrayBrackets}).QueryStruct(&f)
+	expected := "sort=asc&page=2&status[]=open&status[]=closed&since=2024-01-02T03%3A04%3A05Z&labels[team]=core"
+	if r.URL.RawQuery != expected {
+		t.Errorf("Expected query %q, got %q", expected, r.URL.RawQuery)
+	}
+
+	r = Get("/issues").QueryMap(map[string]string{"b": "2", "a": "1"}).QueryStruct(page{Page: 1, PageSize: 10})
+	if r.URL.RawQuery != "a=1&b=2&page=1&page_size=10" {
+		t.Errorf("Expected query params in order, got %q", r.URL.RawQuery)
+	}
+
+	if err := Get("/issues").QueryStruct("nope").Send().Done(); err == nil {
+		t.Error("Expected an error for a value that is not a struct")
+	}
+}
+
+func TestEachProtobuf(t *testing.T) {
+	uvarint := func(n int) []byte {
+		b := make([]byte, binary.MaxVarintLen64)
+		return b[:binary.PutUvarint(b, uint64(n))]
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-protobuf-stream")
+		for _, msg := range []string{"first", "", strings.Repeat("x", 300)} {
+			w.Write(uvarint(len(msg)))
+			w.Write([]byte(msg))
+			w.(http.Flusher).Flush()
+		}
+		if r.URL.Query().Get("truncated") != "" {
+			w.Write(uvarint(10))
+			w.Write([]byte("short"))
+		}
+	}))
+	defer ts.Close()
+
+	var messages []string
+	err := Get(ts.URL).Send().ExpectType("protobuf-stream").EachProtobuf(func(msg []byte) error {
+		messages = append(messages, string(msg))
+		return nil
+	}).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(messages) != 3 || messages[0] != "first" || messages[1] != "" || len(messages[2]) != 300 {
+		t.Errorf("Expected 3 messages, got %q", messages)
+	}
+
+	err = Get(ts.URL).QueryParam("truncated", "1").Send().EachProtobuf(func([]byte) error { return nil }).Done()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected a truncated stream to fail, got %v", err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = Get(ts.URL).Send().EachProtobuf(func([]byte) error {
+		calls++
+		return stop
+	}).Done()
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Expected the callback's error to stop the stream, got %d calls: %v", calls, err)
+	}
+}
+
+func TestWriteResponse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Request-Id", "abc")
+		w.Header().Set("X-Internal", "secret")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "created")
+	}))
+	defer upstream.Close()
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := Get(upstream.URL).WithContext(r.Context()).Send().
+			WriteResponse(w, []string{"Content-Type", "x-request-id", "Transfer-Encoding"}).
+			Done()
+		if err != nil {
+			t.Error(err.Error())
+		}
+	}))
+	defer gateway.Close()
+
+	resp, err := http.Get(gateway.URL)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated || string(body) != "created" {
+		t.Errorf("Expected the upstream reply, got %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("X-Request-Id") != "abc" || resp.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected allowlisted headers to be copied, got %v", resp.Header)
+	}
+	if resp.Header.Get("X-Internal") != "" {
+		t.Error("Expected headers outside the allowlist not to be copied")
+	}
+}
+
+func TestParams(t *testing.T) {
+	req := Get("http://example.com/orgs/{org}/repos/:repo/issues/:number").
+		Params(map[string]string{"org": "a/b", "repo": "100%"}).
+		ParamInt("number", 42)
+	if req.err != nil {
+		t.Fatal(req.err.Error())
+	}
+	expected := "http://example.com/orgs/a%2Fb/repos/100%25/issues/42"
+	if req.URL.String() != expected {
+		t.Errorf("Expected url %q, got %q", expected, req.URL.String())
+	}
+}
+
+func TestCacheCredentials(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	client := NewClient().Cache(0)
+	get := func(auth, cc string) string {
+		var body string
+		req := client.Get(ts.URL).QueryParam("cc", cc)
+		if auth != "" {
+			req.Header("Authorization", auth)
+		}
+		req.Send().GetBody(&body)
+		return body
+	}
+
+	if get("alice", "private, max-age=60") != "alice" || get("bob", "private, max-age=60") != "bob" {
+		t.Error("Expected private responses not to be shared between principals")
+	}
+	if get("", "private, max-age=60"); hits != 3 {
+		t.Errorf("Expected private responses not to be cached, got %d hits", hits)
+	}
+
+	hits = 0
+	get("alice", "max-age=60")
+	get("alice", "max-age=60")
+	if hits != 2 {
+		t.Errorf("Expected responses to requests with credentials not to be cached, got %d hits", hits)
+	}
+
+	hits = 0
+	get("", "public, max-age=60")
+	get("", "public, max-age=60")
+	if hits != 1 {
+		t.Errorf("Expected public responses to be cached, got %d hits", hits)
+	}
+}
+
+func TestCacheVaryCredentials(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		// no Vary: Authorization, as most upstreams do
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	client := NewClient().Cache(0)
+	get := func(auth string) string {
+		var body string
+		client.Get(ts.URL).Header("Authorization", auth).Send().GetBody(&body)
+		return body
+	}
+	if get("alice") != "alice" || get("bob") != "bob" || get("alice") != "alice" {
+		t.Fatal("Expected each principal to get its own response")
+	}
+	if hits != 2 {
+		t.Errorf("Expected 2 requests to reach the server, got %d", hits)
+	}
+}
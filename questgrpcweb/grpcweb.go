@@ -0,0 +1,126 @@
+package questgrpcweb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strconv"
+)
+
+// ContentType is the content type of binary grpc-web requests and responses
+const ContentType = "application/grpc-web+proto"
+
+const (
+	headerLen      = 5
+	flagTrailer    = 0x80
+	flagCompressed = 0x01
+)
+
+// MaxMessageSize is the largest frame Unframe accepts, like the 4 MiB default of
+// grpc servers. It guards against a corrupt frame header allocating a huge buffer.
+var MaxMessageSize = 4 << 20
+
+// Status is the error returned for a call that finished with a non-zero grpc-status
+type Status struct {
+	Code    int
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("grpc-web: status %d: %s", s.Code, s.Message)
+}
+
+// Result is an unframed grpc-web unary response
+type Result struct {
+	Message  []byte
+	Trailers http.Header
+}
+
+// Frame returns msg (a serialized protobuf message) prefixed with a grpc-web frame
+// header, ready to be sent as a unary request body
+func Frame(msg []byte) *bytes.Buffer {
+	buf := bytes.NewBuffer(make([]byte, 0, headerLen+len(msg)))
+	buf.WriteByte(0)
+	binary.Write(buf, binary.BigEndian, uint32(len(msg)))
+	buf.Write(msg)
+	return buf
+}
+
+// Unframe reads a grpc-web unary response body, returning its message and trailers.
+// header is the response header, which holds the status for trailers-only responses.
+// A non-zero grpc-status is returned as a *Status error.
+func Unframe(header http.Header, body io.Reader) (*Result, error) {
+	result := &Result{Trailers: http.Header{}}
+	for {
+		var prefix [headerLen]byte
+		if _, err := io.ReadFull(body, prefix[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("grpc-web: reading frame header: %v", err)
+		}
+
+		flags := prefix[0]
+		length := binary.BigEndian.Uint32(prefix[1:])
+		if uint64(length) > uint64(MaxMessageSize) {
+			return nil, fmt.Errorf("grpc-web: frame of %d bytes exceeds the maximum of %d", length, MaxMessageSize)
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(body, data); err != nil {
+			return nil, fmt.Errorf("grpc-web: reading frame: %v", err)
+		}
+
+		switch {
+		case flags&flagTrailer != 0:
+			trailers, err := parseTrailers(data)
+			if err != nil {
+				return nil, err
+			}
+			result.Trailers = trailers
+		case flags&flagCompressed != 0:
+			return nil, errors.New("grpc-web: compressed messages are not supported")
+		case result.Message != nil:
+			return nil, errors.New("grpc-web: unary response has more than one message")
+		default:
+			result.Message = data
+		}
+	}
+	io.Copy(ioutil.Discard, body)
+
+	status := result.Trailers.Get("Grpc-Status")
+	message := result.Trailers.Get("Grpc-Message")
+	if status == "" {
+		status = header.Get("Grpc-Status")
+		message = header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return nil, errors.New("grpc-web: response has no grpc-status")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("grpc-web: invalid grpc-status %q", status)
+	}
+	if code != 0 {
+		return result, &Status{Code: code, Message: message}
+	}
+	return result, nil
+}
+
+// parseTrailers parses a trailer frame, which is encoded like an HTTP/1 header block
+func parseTrailers(data []byte) (http.Header, error) {
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		data = append(data, '\r', '\n')
+	}
+	data = append(data, '\r', '\n')
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(data)))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("grpc-web: reading trailers: %v", err)
+	}
+	return http.Header(header), nil
+}
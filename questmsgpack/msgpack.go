@@ -0,0 +1,33 @@
+// Package questmsgpack registers github.com/vmihailenco/msgpack as the codec quest
+// uses for application/msgpack, e.g. for MsgpackBody and GetMsgpack:
+//
+//	import _ "github.com/nicksrandall/quest/questmsgpack"
+package questmsgpack
+
+import (
+	"io"
+
+	"github.com/nicksrandall/quest"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ContentType is the media type of MessagePack bodies
+const ContentType = "application/msgpack"
+
+var mediaTypes = []string{ContentType, "application/x-msgpack"}
+
+func init() {
+	for _, mediaType := range mediaTypes {
+		quest.RegisterCodec(mediaType, quest.Codec{Encode: Encode, Decode: Decode})
+	}
+}
+
+// Encode writes the MessagePack encoding of v to w
+func Encode(w io.Writer, v interface{}) error {
+	return msgpack.NewEncoder(w).Encode(v)
+}
+
+// Decode reads a MessagePack value from r into v
+func Decode(r io.Reader, v interface{}) error {
+	return msgpack.NewDecoder(r).Decode(v)
+}
@@ -0,0 +1,28 @@
+package questmsgpack
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nicksrandall/quest"
+)
+
+func TestRegistered(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	type point struct{ X, Y int }
+	var out, auto point
+	err := quest.Post(ts.URL).MsgpackBody(point{1, 2}).Send().GetMsgpack(&out).GetAuto(&auto).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if out != (point{1, 2}) || auto != out {
+		t.Errorf("Unexpected decoded values %+v, %+v", out, auto)
+	}
+}
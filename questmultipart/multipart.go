@@ -2,6 +2,7 @@ package questmultipart
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -14,30 +15,159 @@ type Form struct {
 	Buffer *bytes.Buffer
 	Writer *multipart.Writer
 	Err    error
+	parts  []part
 }
 
 type Encoder func(io.Writer, interface{}) error
 
-func New() *Form {
+// Option configures a Form created with New
+type Option func(*Form)
+
+// Boundary sets the boundary of the form instead of a random one
+func Boundary(boundary string) Option {
+	return func(f *Form) {
+		if err := f.Writer.SetBoundary(boundary); err != nil {
+			f.Err = err
+		}
+	}
+}
+
+func New(opts ...Option) *Form {
 	buffer := &bytes.Buffer{}
 	writer := multipart.NewWriter(buffer)
-	return &Form{buffer, writer, nil}
+	f := &Form{Buffer: buffer, Writer: writer}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
-func (f *Form) AddFile(fieldName, fileName string, value interface{}, encoder Encoder) *Form {
+// Size returns the size of the encoded form in bytes, including the closing
+// boundary if the form has not been closed yet
+func (f *Form) Size() int64 {
+	size := int64(f.Buffer.Len())
+	if !bytes.HasSuffix(f.Buffer.Bytes(), f.closing()) {
+		size += int64(len("\r\n") + len(f.closing()))
+	}
+	return size
+}
+
+// closing returns the delimiter written by Close
+func (f *Form) closing() []byte {
+	return []byte("--" + f.Writer.Boundary() + "--\r\n")
+}
+
+// FileOption configures a single part added with AddFile
+type FileOption func(*part)
+
+// Progress calls fn with the number of bytes of the part sent so far, as the form
+// is read for the body of a request
+func Progress(fn func(written int64)) FileOption {
+	return func(p *part) {
+		p.progress = fn
+	}
+}
+
+// Context aborts the part once ctx is done: encoding it sets the form's Err, and
+// reading it for the body of a request fails with ctx's error
+func Context(ctx context.Context) FileOption {
+	return func(p *part) {
+		p.ctx = ctx
+	}
+}
+
+func (f *Form) AddFile(fieldName, fileName string, value interface{}, encoder Encoder, opts ...FileOption) *Form {
 	fileWriter, err := f.Writer.CreateFormFile(fieldName, fileName)
 	if err != nil {
 		f.Err = err
 		return f
 	}
-	err = encoder(fileWriter, value)
+	p := part{ctx: context.Background(), start: int64(f.Buffer.Len())}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	err = encoder(&partWriter{w: fileWriter, ctx: p.ctx}, value)
 	if err != nil {
 		f.Err = err
 		return f
 	}
+	p.end = int64(f.Buffer.Len())
+	f.parts = append(f.parts, p)
 	return f
 }
 
+// part is the content of a file in Buffer, with the options it was added with
+type part struct {
+	ctx        context.Context
+	progress   func(written int64)
+	start, end int64
+}
+
+// partWriter checks for cancellation while a part is encoded
+type partWriter struct {
+	w   io.Writer
+	ctx context.Context
+}
+
+func (w *partWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// progressChunk is the most read between progress reports
+const progressChunk = 32 * 1024
+
+// Reader returns a reader over the encoded form that reports the progress of, and
+// checks the context of, the parts added with those options as they are read
+func (f *Form) Reader() io.Reader {
+	return &formReader{data: f.Buffer.Bytes(), parts: f.parts}
+}
+
+type formReader struct {
+	data  []byte
+	pos   int64
+	parts []part
+}
+
+func (r *formReader) Read(p []byte) (int, error) {
+	if r.pos >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	limit := int64(len(r.data))
+	var current *part
+	for i := range r.parts {
+		pt := &r.parts[i]
+		if r.pos >= pt.end {
+			continue
+		}
+		if r.pos < pt.start {
+			limit = pt.start
+		} else {
+			current, limit = pt, pt.end
+			if limit-r.pos > progressChunk {
+				limit = r.pos + progressChunk
+			}
+		}
+		break
+	}
+	if current != nil {
+		if err := current.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > limit-r.pos {
+		p = p[:limit-r.pos]
+	}
+	n := copy(p, r.data[r.pos:])
+	r.pos += int64(n)
+	if current != nil && current.progress != nil {
+		current.progress(r.pos - current.start)
+	}
+	return n, nil
+}
+
 func (f *Form) AddField(name, value string) *Form {
 	err := f.Writer.WriteField(name, value)
 	if err != nil {
@@ -0,0 +1,37 @@
+// Package questyaml registers gopkg.in/yaml.v3 as the codec quest uses for
+// application/yaml, e.g. for YAMLBody and GetYAML:
+//
+//	import _ "github.com/nicksrandall/quest/questyaml"
+package questyaml
+
+import (
+	"io"
+
+	"github.com/nicksrandall/quest"
+	"gopkg.in/yaml.v3"
+)
+
+// ContentType is the media type of YAML bodies
+const ContentType = "application/yaml"
+
+var mediaTypes = []string{ContentType, "application/x-yaml", "text/yaml", "text/x-yaml"}
+
+func init() {
+	for _, mediaType := range mediaTypes {
+		quest.RegisterCodec(mediaType, quest.Codec{Encode: Encode, Decode: Decode})
+	}
+}
+
+// Encode writes the YAML encoding of v to w
+func Encode(w io.Writer, v interface{}) error {
+	enc := yaml.NewEncoder(w)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Decode decodes the first YAML document read from r into v
+func Decode(r io.Reader, v interface{}) error {
+	return yaml.NewDecoder(r).Decode(v)
+}
@@ -0,0 +1,51 @@
+package questyaml
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nicksrandall/quest"
+)
+
+type port struct {
+	Name string `yaml:"name"`
+	Port int    `yaml:"port"`
+}
+
+func TestRegistered(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	var body string
+	var out, auto port
+	err := quest.Post(ts.URL).YAMLBody(port{"http", 80}).Send().GetBody(&body).GetYAML(&out).GetAuto(&auto).Done()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if body != "name: http\nport: 80\n" || out != (port{"http", 80}) || auto != out {
+		t.Errorf("Unexpected results %q, %+v, %+v", body, out, auto)
+	}
+}
+
+func TestDecodeAliases(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		io.WriteString(w, "base: &base\n  name: http\n  port: 80\nports:\n  - *base\n  - <<: *base\n    port: 8080\n")
+	}))
+	defer ts.Close()
+
+	var out struct {
+		Ports []port `yaml:"ports"`
+	}
+	if err := quest.Get(ts.URL).Send().GetYAML(&out).Done(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(out.Ports) != 2 || out.Ports[0] != (port{"http", 80}) || out.Ports[1] != (port{"http", 8080}) {
+		t.Errorf("Unexpected ports %+v", out.Ports)
+	}
+}
@@ -0,0 +1,110 @@
+package quest
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit parses the rate limit headers of the response. Both the standard
+// "RateLimit-*" headers (or the combined "RateLimit" header) and the common vendor
+// "X-RateLimit-*" / "X-Rate-Limit-*" headers are understood.
+//
+// limit and remaining are -1 when the upstream did not send them and reset is the
+// zero time when no reset was sent.
+func (r *Response) RateLimit() (limit, remaining int, reset time.Time) {
+	limit, remaining = -1, -1
+	if r.Response == nil {
+		return limit, remaining, reset
+	}
+	header := r.Response.Header
+	now := r.req.clock().Now()
+
+	// combined form: RateLimit: limit=100, remaining=50, reset=30
+	if combined := header.Get("RateLimit"); combined != "" {
+		for _, part := range strings.Split(combined, ",") {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch strings.ToLower(kv[0]) {
+			case "limit":
+				limit = parseRateLimitInt(kv[1], limit)
+			case "remaining":
+				remaining = parseRateLimitInt(kv[1], remaining)
+			case "reset":
+				reset = parseRateLimitReset(kv[1], now, reset)
+			}
+		}
+	}
+
+	for _, prefix := range []string{"RateLimit-", "X-RateLimit-", "X-Rate-Limit-"} {
+		if v := header.Get(prefix + "Limit"); v != "" && limit < 0 {
+			limit = parseRateLimitInt(v, limit)
+		}
+		if v := header.Get(prefix + "Remaining"); v != "" && remaining < 0 {
+			remaining = parseRateLimitInt(v, remaining)
+		}
+		if v := header.Get(prefix + "Reset"); v != "" && reset.IsZero() {
+			reset = parseRateLimitReset(v, now, reset)
+		}
+	}
+	return limit, remaining, reset
+}
+
+func parseRateLimitInt(value string, fallback int) int {
+	// some upstreams send a quota policy after the number, e.g. "100;w=60"
+	value = strings.TrimSpace(strings.SplitN(value, ";", 2)[0])
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// parseRateLimitReset understands both delta seconds and unix timestamps
+func parseRateLimitReset(value string, now, fallback time.Time) time.Time {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return fallback
+	}
+	// nobody sends a window longer than a year, so large values are timestamps
+	if n > 365*24*60*60 {
+		return time.Unix(n, 0)
+	}
+	return now.Add(time.Duration(n) * time.Second)
+}
+
+// RespectRateLimit makes the client hold back requests to a host once a response
+// from that host reports no remaining quota, until the reported reset time
+func (c *Client) RespectRateLimit() *Client {
+	c.rateLimits = &rateLimits{until: map[string]time.Time{}}
+	return c
+}
+
+// rateLimits tracks when each host's rate limit window resets
+type rateLimits struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// wait blocks until host's rate limit window has reset or the context is done
+func (l *rateLimits) wait(ctx context.Context, clock Clock, host string) error {
+	l.mu.Lock()
+	until := l.until[host]
+	l.mu.Unlock()
+	return sleep(ctx, clock, until.Sub(clock.Now()))
+}
+
+// observe records the rate limit reported by resp
+func (l *rateLimits) observe(host string, resp *Response) {
+	_, remaining, reset := resp.RateLimit()
+	if remaining != 0 || reset.IsZero() {
+		return
+	}
+	l.mu.Lock()
+	l.until[host] = reset
+	l.mu.Unlock()
+}
@@ -0,0 +1,73 @@
+package quest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// RawJSON returns the undecoded JSON at a dot separated path in the response body
+// (e.g. "data.items.0.payload"), so parts of a response can be decoded later or
+// conditionally. Numeric keys index into arrays and an empty path returns the
+// whole body. The body can still be read afterwards.
+func (r *Response) RawJSON(path string) (json.RawMessage, error) {
+	if r.req.err != nil {
+		return nil, r.req.err
+	}
+	b, err := r.readBody()
+	if err != nil {
+		return nil, handleResponseError(err, r.req, r)
+	}
+	value := lookupPath(jsoniter.Get(b), path)
+	if err := value.LastError(); err != nil || value.ValueType() == jsoniter.InvalidValue {
+		err = fmt.Errorf("Invalid Path. Expected %q in body, got none", path)
+		return nil, handleResponseError(err, r.req, r)
+	}
+	raw, err := jsoniter.Marshal(value)
+	if err != nil {
+		return nil, handleResponseError(err, r.req, r)
+	}
+	return raw, nil
+}
+
+// GetJSONPolymorphic decodes a union-typed response body. The string at
+// discriminatorPath (e.g. "type") selects the constructor in registry whose value
+// the body is decoded into, and that value is stored in into.
+func (r *Response) GetJSONPolymorphic(discriminatorPath string, registry map[string]func() interface{}, into *interface{}) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	b, err := r.readBody()
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	if err := r.notJSON(b); err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+
+	discriminator := lookupPath(jsoniter.Get(b), discriminatorPath)
+	kind := discriminator.ToString()
+	newValue, ok := registry[kind]
+	if discriminator.ValueType() != jsoniter.StringValue || !ok {
+		kinds := make([]string, 0, len(registry))
+		for k := range registry {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		err := fmt.Errorf("Invalid Type. Expected %q to be one of %q, got %q", discriminatorPath, kinds, kind)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+
+	value := newValue()
+	if err := r.req.json().Unmarshal(b, value); err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	*into = value
+	return r
+}
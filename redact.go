@@ -0,0 +1,141 @@
+package quest
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+)
+
+// redacted replaces secrets in errors, debug output and captured exchanges
+const redacted = "REDACTED"
+
+var redaction = struct {
+	sync.RWMutex
+	headers  map[string]bool
+	patterns []*regexp.Regexp
+}{
+	headers: map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"Cookie":              true,
+		"Set-Cookie":          true,
+	},
+}
+
+// RedactHeaders adds headers whose values are hidden in errors, Debug output and
+// captured exchanges.
+// Authorization, Proxy-Authorization, Cookie and Set-Cookie are always hidden.
+func RedactHeaders(names ...string) {
+	redaction.Lock()
+	defer redaction.Unlock()
+	for _, name := range names {
+		redaction.headers[http.CanonicalHeaderKey(name)] = true
+	}
+}
+
+// RedactPattern hides every match of pattern in the URLs, header values and bodies
+// shown in errors and Debug output. If pattern has groups only the groups are
+// hidden, e.g. `"password":\s*"([^"]*)"` keeps the key.
+func RedactPattern(pattern *regexp.Regexp) {
+	redaction.Lock()
+	redaction.patterns = append(redaction.patterns, pattern)
+	redaction.Unlock()
+}
+
+func redactsHeader(name string) bool {
+	redaction.RLock()
+	defer redaction.RUnlock()
+	return redaction.headers[http.CanonicalHeaderKey(name)]
+}
+
+// redactString hides every match of the redaction patterns in s
+func redactString(s string) string {
+	redaction.RLock()
+	patterns := redaction.patterns
+	redaction.RUnlock()
+	for _, pattern := range patterns {
+		s = redactPattern(pattern, s)
+	}
+	return s
+}
+
+func redactPattern(pattern *regexp.Regexp, s string) string {
+	if pattern.NumSubexp() == 0 {
+		return pattern.ReplaceAllString(s, redacted)
+	}
+	var b bytes.Buffer
+	last := 0
+	for _, match := range pattern.FindAllStringSubmatchIndex(s, -1) {
+		for i := 2; i < len(match); i += 2 {
+			start, end := match[i], match[i+1]
+			if start < last || start < 0 {
+				continue
+			}
+			b.WriteString(s[last:start])
+			b.WriteString(redacted)
+			last = end
+		}
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func redactHeaderMap(headers map[string]string) map[string]string {
+	clean := make(map[string]string, len(headers))
+	for key, value := range headers {
+		if redactsHeader(key) {
+			value = redacted
+		}
+		clean[key] = redactString(value)
+	}
+	return clean
+}
+
+// redactHeader returns a copy of header with sensitive values replaced
+func redactHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+	clean := make(http.Header, len(header))
+	for key, values := range header {
+		cleanValues := make([]string, len(values))
+		for i, value := range values {
+			if redactsHeader(key) {
+				value = redacted
+			}
+			cleanValues[i] = redactString(value)
+		}
+		clean[key] = cleanValues
+	}
+	return clean
+}
+
+// redactURL returns a copy of u without its password and with the redaction
+// patterns applied to its query
+func redactURL(u *url.URL) *url.URL {
+	if u == nil {
+		return nil
+	}
+	clean := *u
+	if _, ok := clean.User.Password(); ok {
+		clean.User = url.UserPassword(clean.User.Username(), redacted)
+	}
+	clean.RawQuery = redactString(clean.RawQuery)
+	return &clean
+}
+
+// redactDump hides secrets in a request or response in wire format
+func redactDump(dump []byte) []byte {
+	lines := bytes.Split(dump, []byte("\r\n"))
+	for i, line := range lines {
+		if len(line) == 0 {
+			break // end of the headers
+		}
+		if colon := bytes.IndexByte(line, ':'); colon > 0 && redactsHeader(string(line[:colon])) {
+			lines[i] = append(line[:colon:colon], ": "+redacted...)
+		}
+	}
+	return []byte(redactString(string(bytes.Join(lines, []byte("\r\n")))))
+}
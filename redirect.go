@@ -0,0 +1,161 @@
+package quest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxRedirects matches the number of redirects net/http follows by default
+const maxRedirects = 10
+
+// errTooManyRedirects is returned when a request is redirected more than maxRedirects times
+var errTooManyRedirects = fmt.Errorf("stopped after %d redirects", maxRedirects)
+
+// credentialHeaders are dropped from a redirected request when it leaves the
+// original host
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Cookie2"}
+
+// NoRedirects stops the request from following redirects so the redirect response
+// itself is returned, e.g. to read its Location with GetLocation
+func (r *Request) NoRedirects() *Request {
+	if r.err != nil {
+		return r
+	}
+	r.noRedirects = true
+	return r
+}
+
+// NoRedirects stops every request on this client from following redirects
+func (c *Client) NoRedirects() *Client {
+	c.noRedirects = true
+	return c
+}
+
+// AllowRedirectCredentials allows credential headers (Authorization, Cookie) to be
+// forwarded when a redirect goes to one of the given hosts. A host may start with
+// "*." to match any of its subdomains.
+//
+// By default credentials are stripped whenever a redirect crosses to a different host.
+func (r *Request) AllowRedirectCredentials(hosts ...string) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.redirectHosts = append(r.redirectHosts, hosts...)
+	return r
+}
+
+// AllowRedirectCredentials allows credential headers to be forwarded when a redirect
+// from any request on this client goes to one of the given hosts
+func (c *Client) AllowRedirectCredentials(hosts ...string) *Client {
+	c.redirectHosts = append(c.redirectHosts, hosts...)
+	return c
+}
+
+// checkRedirect is used as the http.Client's CheckRedirect policy
+func (r *Request) checkRedirect(req *http.Request, via []*http.Request) error {
+	if r.noRedirects || (r.client != nil && r.client.noRedirects) {
+		return http.ErrUseLastResponse
+	}
+	if len(via) >= maxRedirects {
+		return errTooManyRedirects
+	}
+
+	if strings.EqualFold(req.URL.Scheme, "http") && r.tlsPolicy() >= tlsRequire {
+		// never follow a downgrade, even when upgrading the original url
+		return fmt.Errorf("%w: redirect to %q", ErrPlaintextNotAllowed, req.URL.String())
+	}
+	if r.client != nil {
+		if err := r.client.checkHost(req.URL); err != nil {
+			return err
+		}
+		r.client.stripScopedHeaders(req)
+	}
+
+	origin := via[0]
+	if strings.EqualFold(origin.URL.Hostname(), req.URL.Hostname()) {
+		return nil
+	}
+
+	hosts := r.redirectHosts
+	if r.client != nil {
+		hosts = append(append([]string(nil), r.redirectHosts...), r.client.redirectHosts...)
+	}
+	if matchAnyHost(hosts, req.URL.Hostname()) {
+		// net/http may have already dropped these so copy them from the original request
+		for _, key := range credentialHeaders {
+			if value, ok := origin.Header[key]; ok {
+				req.Header[key] = value
+			}
+		}
+		return nil
+	}
+
+	for _, key := range credentialHeaders {
+		req.Header.Del(key)
+	}
+	return nil
+}
+
+// ExpectRedirect will error if StatusCode is not the given redirect code (or any 3xx
+// code when code is zero) or the response has no Location header
+func (r *Response) ExpectRedirect(code int) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	actual := r.Response.StatusCode
+	if (code == 0 && (actual < 300 || actual >= 400)) || (code != 0 && actual != code) {
+		expected := "to be in 300 range"
+		if code != 0 {
+			expected = fmt.Sprintf("to be '%d'", code)
+		}
+		err := newStatusError("Invalid StatusCode. Expected redirect %s, got '%d'", expected, actual)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	if r.Response.Header.Get("Location") == "" {
+		err := fmt.Errorf("Invalid Header. Expected redirect to have a \"Location\" header")
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	return r
+}
+
+// GetLocation stores the Location header, resolved against the request url, into
+// into parameter
+func (r *Response) GetLocation(into *string) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	location, err := r.Response.Location()
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	*into = location.String()
+	return r
+}
+
+// matchHost reports whether host matches pattern. A pattern of "*.example.com"
+// matches any subdomain of example.com but not example.com itself and a pattern of
+// "*" matches every host.
+func matchHost(pattern, host string) bool {
+	if pattern == "*" {
+		return true
+	}
+	pattern = strings.ToLower(pattern)
+	host = strings.ToLower(host)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return pattern == host
+}
+
+func matchAnyHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if matchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package quest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// registry is a ring buffer of the most recent exchanges
+var registry struct {
+	sync.Mutex
+	exchanges []*Exchange
+	next      int
+	full      bool
+}
+
+// RecordExchanges keeps a record of the last n requests sent by this process, with
+// secrets redacted and without bodies, for DebugHandler and RecentExchanges. Zero
+// (the default) disables recording.
+func RecordExchanges(n int) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.exchanges = nil
+	registry.next = 0
+	registry.full = false
+	if n > 0 {
+		registry.exchanges = make([]*Exchange, n)
+	}
+}
+
+// RecentExchanges returns the recorded exchanges, newest first
+func RecentExchanges() []*Exchange {
+	registry.Lock()
+	defer registry.Unlock()
+	n := registry.next
+	if registry.full {
+		n = len(registry.exchanges)
+	}
+	recent := make([]*Exchange, 0, n)
+	for i := 1; i <= n; i++ {
+		j := (registry.next - i + len(registry.exchanges)) % len(registry.exchanges)
+		recent = append(recent, registry.exchanges[j])
+	}
+	return recent
+}
+
+// record adds the exchange of a sent request to the registry, if it is enabled
+func (r *Response) record(err error) {
+	registry.Lock()
+	defer registry.Unlock()
+	if len(registry.exchanges) == 0 {
+		return
+	}
+
+	e := &Exchange{
+		Method:        r.req.method,
+		URL:           redactURL(r.req.URL).String(),
+		RequestHeader: redactHeader(r.sentHeader),
+		Started:       r.started,
+		Latency:       r.latency,
+		Attempts:      r.attempts.list(),
+	}
+	if r.Response != nil && r.Response.StatusCode != 0 {
+		e.StatusCode = r.Response.StatusCode
+		e.ResponseHeader = redactHeader(r.Response.Header)
+	}
+	if err != nil {
+		e.Error = redactString(err.Error())
+	}
+
+	registry.exchanges[registry.next] = e
+	registry.next++
+	if registry.next == len(registry.exchanges) {
+		registry.next = 0
+		registry.full = true
+	}
+}
+
+// DebugHandler serves the recorded exchanges (see RecordExchanges) as JSON, newest
+// first, so operators can inspect the outbound calls of a running service. They
+// can be filtered with query parameters:
+//
+//	method=POST     only POST requests
+//	host=example    only urls containing "example"
+//	status=503      only a status code, or a class like "5xx"
+//	error=true      only requests that failed without a response
+//	limit=10        at most 10 exchanges
+func DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+
+		exchanges := []*Exchange{}
+		for _, e := range RecentExchanges() {
+			if limit > 0 && len(exchanges) == limit {
+				break
+			}
+			if matchExchange(e, query.Get("method"), query.Get("host"), query.Get("status"), query.Get("error") == "true") {
+				exchanges = append(exchanges, e)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		b, err := jsoniter.MarshalIndent(exchanges, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(b)
+	})
+}
+
+func matchExchange(e *Exchange, method, host, status string, failed bool) bool {
+	if method != "" && !strings.EqualFold(e.Method, method) {
+		return false
+	}
+	if host != "" && !strings.Contains(e.URL, host) {
+		return false
+	}
+	if failed && e.Error == "" {
+		return false
+	}
+	if status != "" {
+		code := strconv.Itoa(e.StatusCode)
+		if strings.HasSuffix(strings.ToLower(status), "xx") {
+			return e.StatusCode != 0 && code[:1] == status[:1]
+		}
+		return code == status
+	}
+	return true
+}
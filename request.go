@@ -5,11 +5,16 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
-	"strings"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
-	jsoniter "github.com/json-iterator/go"
 	"github.com/nicksrandall/quest/questmultipart"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
@@ -20,12 +25,63 @@ type Request struct {
 	*url.URL
 	transport *http.Transport
 	method    string
-	data      *bytes.Buffer
+	body      bodyFunc
 	headers   map[string]string
 	err       error
 	ctx       context.Context
+	client    *Client
+
+	redirectHosts  []string
+	noRedirects    bool
+	bodyFile       string
+	sharedBody     bool
+	steps          []Step
+	batch          []*Request
+	signer         Signer
+	localSkew      *clockSkew
+	localAddr      string
+	decompress     decompressLimits
+	clockOverride  Clock
+	randOverride   *lockedRand
+	tls            tlsPolicy
+	headerLint     func(HeaderWarning)
+	strictHeaders  bool
+	stepName       string
+	naming         *NamingStrategy
+	phases         phaseTimeouts
+	closeConn      bool
+	noKeepAlive    bool
+	validateJSON   bool
+	template       string
+	operation      string
+	priority       Priority
+	httpClient     *http.Client
+	retries        int
+	backoff        Backoff
+	maxRetryAfter  time.Duration
+	middleware     []Middleware
+	beforeSend     []func(*http.Request)
+	afterReceive   []func(*Response)
+	span           opentracing.SpanContext
+	jsonOpts       *JSONOptions
+	timings        *timingTrace
+	maxHeaderBytes int64
+	log            requestLogger
+	debug          io.Writer
+	maxURLLength   int
+	urlValidators  []URLValidator
+	rawPath        string
+	formOpts       *FormOptions
+	query          []formParam
+	encodedQuery   string
+	fallback       *fallback
+	form           []formParam
 }
 
+// bodyFunc returns a fresh reader over the request body along with its size, or
+// -1 if the size is unknown
+type bodyFunc func() (io.ReadCloser, int64, error)
+
 // New creates a new request with given http method and path (uri)
 func New(method, path string) *Request {
 	u, err := url.Parse(path)
@@ -34,13 +90,13 @@ func New(method, path string) *Request {
 	}
 
 	return &Request{
-		URL:    u,
-		method: method,
+		URL:     u,
+		method:  method,
+		rawPath: path,
 		headers: map[string]string{
-			"Accept":     "application/json",
+			"Accept":     DefaultAccept,
 			"User-Agent": "quest/v1",
 		},
-		data: &bytes.Buffer{},
 	}
 }
 
@@ -70,6 +126,22 @@ func (r *Request) WithContext(ctx context.Context) *Request {
 	return r
 }
 
+// WithValue adds a value to the request's context, making it visible to everything
+// that handles the request (e.g. tracing, transports and the http.Request itself)
+func (r *Request) WithValue(key, value interface{}) *Request {
+	r.ctx = context.WithValue(r.Context(), key, value)
+	return r
+}
+
+// Context returns the request's context. If no context was set the background
+// context is returned.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
 // Header sets a header on request with given key and value
 func (r *Request) Header(key, value string) *Request {
 	if r.err != nil {
@@ -89,47 +161,120 @@ func (r *Request) BasicAuth(username, password string) *Request {
 	return r
 }
 
-// QueryParam adds a query param to the url
+// QueryParam adds a query param to the url. Calling it again with the same key
+// adds another value, encoded as set with FormEncoding.
 func (r *Request) QueryParam(key, value string) *Request {
 	if r.err != nil {
 		return r
 	}
+	if opts, ok := r.formOptions(); ok {
+		return r.addQuery(formParam{key, value}, opts)
+	}
 	q := r.URL.Query()
 	q.Add(key, value)
 	r.URL.RawQuery = q.Encode()
+	// params added by QueryStruct are now part of the encoded url
+	r.query, r.encodedQuery = nil, ""
 	return r
 }
 
-// Param replaces url param (denoted with `:key`) with given value
-func (r *Request) Param(key, value string) *Request {
+// Body sets the body for the request
+//
+// The buffer is not consumed when the request is sent so the body can be read
+// again, e.g. when the request is retried.
+func (r *Request) Body(value *bytes.Buffer) *Request {
 	if r.err != nil {
 		return r
 	}
-	path := strings.Replace(r.URL.String(), ":"+key, value, 1)
-	url, err := url.Parse(path)
-	if err != nil {
-		r.err = handleRequestError(err, r)
+	r.body = func() (io.ReadCloser, int64, error) {
+		b := value.Bytes()
+		return ioutil.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+	}
+	r.bodyFile = ""
+	r.sharedBody = false
+	return r
+}
+
+// BodyFunc sets a function that returns the body for the request. It is called
+// every time the body needs to be read (e.g. once per attempt) and must return a
+// fresh reader each time. size is the length of the body or -1 if it is unknown.
+func (r *Request) BodyFunc(fn func() (io.ReadCloser, error), size int64) *Request {
+	if r.err != nil {
 		return r
 	}
-	r.URL = url
+	r.body = func() (io.ReadCloser, int64, error) {
+		rc, err := fn()
+		return rc, size, err
+	}
+	r.bodyFile = ""
+	r.sharedBody = false
 	return r
 }
 
-// Body sets the body for the request
-func (r *Request) Body(value *bytes.Buffer) *Request {
+// GetBody returns a fresh reader over the request body. It returns http.NoBody when
+// the request has no body.
+func (r *Request) GetBody() (io.ReadCloser, error) {
+	if r.body == nil {
+		return http.NoBody, nil
+	}
+	rc, _, err := r.body()
+	return rc, err
+}
+
+// FileBody streams the file at path as the body of the request. If contentType is
+// empty it is guessed from the file's extension.
+func (r *Request) FileBody(path, contentType string) *Request {
 	if r.err != nil {
 		return r
 	}
-	r.data = value
+	info, err := os.Stat(path)
+	if err != nil {
+		r.err = handleRequestError(err, r)
+		return r
+	}
+	if info.IsDir() {
+		r.err = handleRequestError(fmt.Errorf("%q is a directory", path), r)
+		return r
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	r.Header("Content-Type", contentType)
+	r.body = func() (io.ReadCloser, int64, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, info.Size(), nil
+	}
+	r.bodyFile = path
+	r.sharedBody = false
 	return r
 }
 
-// JSONBody sets the given value as a JSON encoded string as the body of the request
+// JSONBody sets the given value as a JSON encoded string as the body of the request.
+// It is encoded with the codec registered for "application/json" if there is one.
 func (r *Request) JSONBody(value interface{}) *Request {
 	if r.err != nil {
 		return r
 	}
-	b, err := jsoniter.Marshal(value)
+	var b []byte
+	var err error
+	if codec, ok := lookupCodec("application/json"); ok && codec.Encode != nil {
+		var buf bytes.Buffer
+		err = codec.Encode(&buf, value)
+		b = buf.Bytes()
+	} else {
+		b, err = r.marshalJSON(value, r.jsonOptions().Indent)
+	}
 	if err != nil {
 		r.err = handleRequestError(err, r)
 		return r
@@ -138,14 +283,44 @@ func (r *Request) JSONBody(value interface{}) *Request {
 	return r.Body(bytes.NewBuffer(b))
 }
 
-// MultipartBody will set a multipart form as the body of the request
+// JSONBodyReader streams pre-encoded JSON from body as the body of the request
+// without decoding it. If body is an io.Seeker it is rewound when the body needs to
+// be read again, otherwise it can only be sent once.
+func (r *Request) JSONBodyReader(body io.Reader) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.Header("Content-Type", "application/json")
+	r.body = readerBody(body)
+	r.bodyFile = ""
+	r.sharedBody = true
+	return r
+}
+
+// ValidateJSONBody checks that the body is well-formed JSON before the request is
+// sent. A streamed body is buffered to validate it.
+func (r *Request) ValidateJSONBody() *Request {
+	r.validateJSON = true
+	return r
+}
+
+// MultipartBody will set a multipart form as the body of the request. The
+// Progress and Context options of its parts apply as the body is sent.
 func (r *Request) MultipartBody(form *questmultipart.Form) *Request {
 	if r.err != nil {
 		return r
 	}
 	r.Header("Content-Type", form.Writer.FormDataContentType())
-	r.err = form.Err
-	return r.Body(form.Buffer)
+	if form.Err != nil {
+		r.err = form.Err
+		return r
+	}
+	r.body = func() (io.ReadCloser, int64, error) {
+		return ioutil.NopCloser(form.Reader()), int64(form.Buffer.Len()), nil
+	}
+	r.bodyFile = ""
+	r.sharedBody = false
+	return r
 }
 
 // WithTransport sets the transport for the http client
@@ -158,7 +333,22 @@ func (r *Request) WithTransport(transport *http.Transport) *Request {
 }
 
 // Send sends the request and returns the response
+//
+// The request passes through the middleware added with Use (package-level first,
+// then the request's own) before it is sent.
 func (r *Request) Send() *Response {
+	if r.err != nil {
+		return r.send()
+	}
+	resp := r.handler()(r)
+	if r.fallback != nil {
+		resp = r.sendFallback(resp)
+	}
+	return resp
+}
+
+// send sends the request without running any middleware
+func (r *Request) send() *Response {
 	if r.err != nil {
 		return &Response{
 			Response: &http.Response{},
@@ -166,12 +356,10 @@ func (r *Request) Send() *Response {
 		}
 	}
 
-	client := &http.Client{}
-	if r.transport != nil {
-		client.Transport = r.transport
-	}
+	attempts := &attemptLog{}
+	client := r.newHTTPClient(attempts)
 
-	req, err := http.NewRequest(r.method, r.URL.String(), r.data)
+	req, err := r.prepare()
 	if err != nil {
 		r.err = handleRequestError(err, r)
 		return &Response{
@@ -180,14 +368,18 @@ func (r *Request) Send() *Response {
 		}
 	}
 
-	for key, value := range r.headers {
-		req.Header.Set(key, value)
-	}
-
 	if r.ctx != nil {
 		req = req.WithContext(r.ctx)
-		span, _ := opentracing.StartSpanFromContext(r.ctx, "Quest: request")
+		operation := "Quest: request"
+		if name := r.operationName(); name != "" {
+			operation = name
+		}
+		span, _ := opentracing.StartSpanFromContext(r.ctx, operation)
+		r.span = span.Context()
 		span.SetTag("http.method", r.method)
+		if r.template != "" {
+			span.SetTag("http.route", r.template)
+		}
 		span.SetTag("http.host", r.URL.Host)
 		span.SetTag("http.path", r.URL.Path)
 		ext.HTTPUrl.Set(
@@ -204,17 +396,369 @@ func (r *Request) Send() *Response {
 		defer span.Finish()
 	}
 
-	resp, err := client.Do(req)
+	releaseOnClose := func(*http.Response) {}
+	if r.client != nil {
+		ctx, finish, err := r.client.inFlight.track(req.Context())
+		if err != nil {
+			closeBody(req)
+			r.err = handleRequestError(err, r)
+			return &Response{
+				Response: &http.Response{},
+				req:      r,
+			}
+		}
+		// the request stays in flight until its body is closed
+		defer func() {
+			if finish != nil {
+				finish()
+			}
+		}()
+		req = req.WithContext(ctx)
+		releaseOnClose = func(resp *http.Response) {
+			resp.Body = &cancelOnClose{resp.Body, finish}
+			finish = nil
+		}
+	}
+
+	var cache *responseCache
+	if r.client != nil && r.client.cache != nil && r.client.cache.cacheable(req) {
+		cache = r.client.cache
+		entry, ok := cache.get(req, r.clock().Now(), r.client.credentialHeaders())
+		if ok {
+			r.client.reportCache(req.URL.Host, entry)
+			return &Response{
+				Response:   entry.response(req),
+				req:        r,
+				started:    r.clock().Now(),
+				sentHeader: req.Header.Clone(),
+				attempts:   attempts,
+				fromCache:  true,
+			}
+		}
+		r.client.reportCache(req.URL.Host, nil)
+	}
+
+	if r.client != nil {
+		if err := r.client.wait(req.Context(), req.URL.Host); err != nil {
+			closeBody(req)
+			r.err = handleRequestError(err, r)
+			return &Response{
+				Response: &http.Response{},
+				req:      r,
+			}
+		}
+	}
+
+	if r.client != nil {
+		if err := r.client.limiter.acquire(req.Context(), r.clock(), r.priority); err != nil {
+			closeBody(req)
+			r.err = handleRequestError(err, r)
+			return &Response{
+				Response: &http.Response{},
+				req:      r,
+			}
+		}
+		// the slot is held until the response body is closed
+		var once sync.Once
+		release := func() { once.Do(r.client.limiter.release) }
+		defer func() {
+			if release != nil {
+				release()
+			}
+		}()
+		closeHooks := releaseOnClose
+		releaseOnClose = func(resp *http.Response) {
+			closeHooks(resp)
+			resp.Body = &cancelOnClose{resp.Body, release}
+			release = nil
+		}
+	}
+
+	// take over decompression from net/http so the limits can be enforced
+	limits := r.decompressLimits()
+	decompress := limits.enabled() && req.Header.Get("Accept-Encoding") == ""
+	if decompress {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+
+	written := new(int64)
+	countRequestBody(req, written)
+
+	for _, hook := range r.beforeSend {
+		hook(req)
+	}
+	if r.client != nil && r.client.breakers != nil {
+		if err := r.client.breakers.allow(req, r.clock().Now()); err != nil {
+			closeBody(req)
+			r.err = handleRequestError(err, r)
+			return &Response{
+				Response: &http.Response{},
+				req:      r,
+			}
+		}
+	}
+	if r.client != nil && r.client.mirror != nil {
+		r.client.mirror.send(r, req)
+	}
+
+	var timer *phaseTimer
+	if phases := r.phaseTimeouts(); phases.enabled() {
+		timer = &phaseTimer{timeouts: phases}
+		req = timer.attach(req)
+	}
+
+	r.timings = &timingTrace{}
+	req = r.timings.attach(req)
+
+	logger := r.logger()
+	if logger != nil {
+		logger.start(r)
+	}
+	done := r.trackInFlight()
+	start := time.Now()
+	resp, tries, err := r.doRetry(client, req)
+	latency := time.Since(start)
+	done()
+	r.reportRequest(resp, err, latency)
+	if logger != nil {
+		logger.finish(r, &Response{Response: resp, req: r, tries: tries}, err, latency)
+	}
+	if timer != nil {
+		resp, err = timer.finish(resp, err)
+	}
+	err = attributeTimeout(err, r.timings.currentPhase())
+	if r.client != nil {
+		r.client.observeBreaker(r, req.URL.Host, resp, err)
+	}
 	if err != nil {
 		r.err = handleRequestError(err, r)
-		return &Response{
-			Response: resp,
-			req:      r,
+		response := &Response{
+			Response:   resp,
+			req:        r,
+			latency:    latency,
+			written:    written,
+			started:    start,
+			sentHeader: req.Header.Clone(),
+			attempts:   attempts,
+			tries:      tries,
+		}
+		response.record(err)
+		return response
+	}
+
+	resp.Body = &timeoutBody{resp.Body, timer}
+	if decompress {
+		decompressResponse(resp, limits)
+	}
+	releaseOnClose(resp)
+
+	response := &Response{
+		Response:   resp,
+		req:        r,
+		latency:    latency,
+		written:    written,
+		started:    start,
+		sentHeader: req.Header.Clone(),
+		attempts:   attempts,
+		tries:      tries,
+	}
+	response.countResponseBody()
+	response.record(nil)
+	if r.client != nil {
+		r.client.observe(req.URL.Host, response)
+	}
+	if cache != nil {
+		cache.store(req, response, r.clock().Now(), r.client.credentialHeaders())
+	}
+	for _, hook := range r.afterReceive {
+		hook(response)
+	}
+	return response
+}
+
+// prepare checks the request and creates the *http.Request that will be sent, with
+// every header applied
+func (r *Request) prepare() (*http.Request, error) {
+	if err := r.lintHeaders(); err != nil {
+		return nil, err
+	}
+	if err := r.checkTLS(r.URL); err != nil {
+		return nil, err
+	}
+	if err := r.checkURL(); err != nil {
+		return nil, err
+	}
+	if r.client != nil {
+		// the url may have changed since the request was created
+		if err := r.client.checkHost(r.URL); err != nil {
+			return nil, err
+		}
+	}
+	if r.validateJSON {
+		if err := r.validateJSONBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := r.newHTTPRequest()
+	if err != nil {
+		return nil, err
+	}
+	if r.client != nil {
+		r.client.applyScopedHeaders(req)
+	}
+	for key, value := range r.headers {
+		req.Header.Set(key, value)
+	}
+	return req, nil
+}
+
+// httpTransport returns the transport the request is sent with, or nil to use
+// http.DefaultTransport
+func (r *Request) httpTransport() *http.Transport {
+	transport := r.transport
+	if transport == nil && r.client != nil {
+		transport = r.client.transport
+	}
+	if r.localAddr != "" {
+		transport = r.boundTransport(transport)
+	}
+	limit := r.maxHeaderBytes
+	if limit == 0 && r.client != nil {
+		limit = r.client.headerLimit
+	}
+	if limit > 0 {
+		transport = r.limitedTransport(transport, limit)
+	}
+	if r.noKeepAlive {
+		transport = r.oneShotTransport(transport)
+	}
+	return transport
+}
+
+// newHTTPRequest creates the *http.Request that will be sent
+func (r *Request) newHTTPRequest() (*http.Request, error) {
+	if r.body == nil {
+		req, err := http.NewRequest(r.method, r.URL.String(), nil)
+		if err == nil {
+			req.Close = r.closeConn || r.noKeepAlive
+		}
+		return req, err
+	}
+
+	body, size, err := r.body()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(r.method, r.URL.String(), body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	if size == 0 {
+		body.Close()
+		req.Body = http.NoBody
+	} else if size > 0 {
+		req.ContentLength = size
+	}
+	req.GetBody = r.GetBody
+	req.Close = r.closeConn || r.noKeepAlive
+	return req, nil
+}
+
+// validateJSONBody buffers the body and checks that it is well-formed JSON
+func (r *Request) validateJSONBody() error {
+	body, err := r.GetBody()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if !r.json().Valid(b) {
+		return fmt.Errorf("request body is not valid JSON")
+	}
+	r.body = func() (io.ReadCloser, int64, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+	}
+	r.sharedBody = false
+	return nil
+}
+
+// readerBody returns a body that reads from rd, rewinding it if it is an io.Seeker
+func readerBody(rd io.Reader) bodyFunc {
+	seeker, canSeek := rd.(io.Seeker)
+	var start int64
+	if canSeek {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			canSeek = false
 		}
 	}
+	read := false
+	return func() (io.ReadCloser, int64, error) {
+		if read {
+			if !canSeek {
+				return nil, 0, fmt.Errorf("body reader can only be read once")
+			}
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, 0, err
+			}
+		}
+		read = true
+		size := int64(-1)
+		if l, ok := rd.(interface{ Len() int }); ok {
+			size = int64(l.Len())
+		}
+		return ioutil.NopCloser(rd), size, nil
+	}
+}
+
+// closeBody releases the body of a request that will not be sent
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// clone returns a copy of the request that can be modified and sent independently
+func (r *Request) clone() *Request {
+	c := *r
+	if r.URL != nil {
+		u := *r.URL
+		c.URL = &u
+	}
+	c.headers = make(map[string]string, len(r.headers))
+	for key, value := range r.headers {
+		c.headers[key] = value
+	}
+	c.redirectHosts = append([]string(nil), r.redirectHosts...)
+	c.middleware = append([]Middleware(nil), r.middleware...)
+	c.beforeSend = append(r.beforeSend[:0:0], r.beforeSend...)
+	c.urlValidators = append(r.urlValidators[:0:0], r.urlValidators...)
+	c.query = append(r.query[:0:0], r.query...)
+	c.form = append(r.form[:0:0], r.form...)
+	c.afterReceive = append(r.afterReceive[:0:0], r.afterReceive...)
+	c.span = nil
+	c.timings = nil
+	return &c
+}
 
-	return &Response{
-		Response: resp,
-		req:      r,
+// bodyString returns the request body for debug output
+func (r *Request) bodyString() string {
+	if r.body == nil {
+		return ""
+	}
+	if r.bodyFile != "" {
+		return fmt.Sprintf("<file %s>", r.bodyFile)
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return fmt.Sprintf("<error reading body: %v>", err)
 	}
+	defer body.Close()
+	b, _ := ioutil.ReadAll(body)
+	return string(b)
 }
@@ -7,7 +7,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
 )
@@ -15,18 +17,38 @@ import (
 // Response is the HTTP response
 type Response struct {
 	*http.Response
-	req *Request
+	req     *Request
+	latency time.Duration
+	written *int64
+	read    *int64
+
+	started    time.Time
+	sentHeader http.Header
+	attempts   *attemptLog
+	fromCache  bool
+	tries      int
+	snapshot   []byte
+	buffered   bool
+
+	flushInterval *time.Duration
 }
 
 // Proxy copies the body of the response to a given writer
-func (r *Response) Proxy(w io.Writer) *Response {
+//
+// If w is an http.ResponseWriter the status code and the given headers (or
+// DefaultProxyHeaders) are copied to it first. If w is an http.Flusher it is flushed
+// periodically so streaming responses reach the client as they arrive.
+func (r *Response) Proxy(w io.Writer, headers ...string) *Response {
 	if r.req.err != nil {
 		return r
 	}
+	r.rewindBody()
 	defer r.Response.Body.Close()
 	var buf bytes.Buffer
 	tee := io.TeeReader(r.Response.Body, &buf)
-	_, err := io.Copy(w, tee)
+	dst, stop := r.proxyWriter(w, headers)
+	_, err := io.Copy(dst, tee)
+	stop()
 	if err != nil {
 		r.req.err = handleResponseError(err, r.req, r)
 	}
@@ -40,7 +62,7 @@ func (r *Response) ExpectSuccess() *Response {
 		return r
 	}
 	if actual := r.Response.StatusCode; actual < 200 || actual >= 300 {
-		err := fmt.Errorf("Invalid StatusCode. Expected to be in 200 range, got '%d'", actual)
+		err := newStatusError("Invalid StatusCode. Expected to be in 200 range, got '%d'", actual)
 		r.req.err = handleResponseError(err, r.req, r)
 		return r
 	}
@@ -53,7 +75,7 @@ func (r *Response) ExpectStatusCode(code int) *Response {
 		return r
 	}
 	if actual := r.Response.StatusCode; actual != code {
-		err := fmt.Errorf("Invalid StatusCode. Expected to be '%d', got '%d'", code, actual)
+		err := newStatusError("Invalid StatusCode. Expected to be '%d', got '%d'", code, actual)
 		r.req.err = handleResponseError(err, r.req, r)
 		return r
 	}
@@ -73,31 +95,58 @@ func (r *Response) ExpectHeader(key, value string) *Response {
 	return r
 }
 
-// ExpectType will error if header "Content-Type" is not specified value
+// ExpectType will error if header "Content-Type" is not specified value, which may
+// be an alias like "json" (see RegisterTypeAlias)
 func (r *Response) ExpectType(value string) *Response {
 	if r.req.err != nil {
 		return r
 	}
 
-	// Types is a map of MIME type aliases
-	var types = map[string]string{
-		"html":       "text/html",
-		"json":       "application/json",
-		"xml":        "application/xml",
-		"text":       "text/plain",
-		"urlencoded": "application/x-www-form-urlencoded",
-		"form":       "application/x-www-form-urlencoded",
-		"form-data":  "application/x-www-form-urlencoded",
+	return r.ExpectHeader("Content-Type", lookupTypeAlias(value))
+}
+
+// ExpectNoBody will error if the response has a body, e.g. an error page returned
+// by a DELETE endpoint. Combine it with ExpectStatusCode(204) to also assert the
+// status.
+func (r *Response) ExpectNoBody() *Response {
+	if r.req.err != nil {
+		return r
 	}
+	b, err := r.readBody()
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	if len(b) > 0 {
+		err := fmt.Errorf("Invalid Body. Expected no body with status '%d', got %d bytes", r.Response.StatusCode, len(b))
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	return r
+}
 
-	var typeValue string
-	if v, ok := types[value]; ok {
-		typeValue = v
-	} else {
-		typeValue = value
+// ExpectLatencyUnder will error if the request took d or longer to get a response
+func (r *Response) ExpectLatencyUnder(d time.Duration) *Response {
+	if r.req.err != nil {
+		return r
 	}
+	if r.latency >= d {
+		err := fmt.Errorf("Invalid Latency. Expected to be under %s, got %s", d, r.latency)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	return r
+}
 
-	return r.ExpectHeader("Content-Type", typeValue)
+// Attempts returns how many times the request was sent to get this response, e.g.
+// more than one when it was retried
+func (r *Response) Attempts() int {
+	return r.tries
+}
+
+// Latency returns how long it took to send the request and receive the response headers
+func (r *Response) Latency() time.Duration {
+	return r.latency
 }
 
 // GetHeader stores header value with key into into paramiter
@@ -109,11 +158,44 @@ func (r *Response) GetHeader(key string, into *string) *Response {
 	return r
 }
 
+// GetHeaderInt parses header value with key as an integer and stores it into into parameter
+func (r *Response) GetHeaderInt(key string, into *int) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	actual := r.Response.Header.Get(key)
+	n, err := strconv.Atoi(strings.TrimSpace(actual))
+	if err != nil {
+		err = fmt.Errorf("Invalid Header. Expected %q header to be an integer, got %q", key, actual)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	*into = n
+	return r
+}
+
+// GetHeaderTime parses header value with key as an http date and stores it into into parameter
+func (r *Response) GetHeaderTime(key string, into *time.Time) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	actual := r.Response.Header.Get(key)
+	t, err := http.ParseTime(actual)
+	if err != nil {
+		err = fmt.Errorf("Invalid Header. Expected %q header to be an http date, got %q", key, actual)
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	*into = t
+	return r
+}
+
 // GetBody stores the response body into into param
 func (r *Response) GetBody(into *string) *Response {
 	if r.req.err != nil {
 		return r
 	}
+	r.rewindBody()
 
 	defer r.Response.Body.Close()
 	var buf bytes.Buffer
@@ -130,48 +212,109 @@ func (r *Response) GetBody(into *string) *Response {
 	return r
 }
 
-// GetJSON decodes and stores the response body
+// readBody reads the whole response body and replaces it so it can be read again
+func (r *Response) readBody() ([]byte, error) {
+	if r.buffered {
+		r.rewindBody()
+		return r.snapshot, nil
+	}
+	defer r.Response.Body.Close()
+	b, err := ioutil.ReadAll(r.Response.Body)
+	r.Response.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, err
+}
+
+// GetJSON decodes and stores the response body. It is decoded with the codec
+// registered for "application/json" if there is one.
 func (r *Response) GetJSON(into interface{}) *Response {
 	if r.req.err != nil {
 		return r
 	}
 
-	defer r.Response.Body.Close()
-	var buf bytes.Buffer
-	tee := io.TeeReader(r.Response.Body, &buf)
-
-	dec := jsoniter.NewDecoder(tee)
-	err := dec.Decode(into)
+	b, err := r.readBody()
+	if err == nil {
+		err = r.notJSON(b)
+	}
+	if err == nil {
+		if codec, ok := lookupCodec("application/json"); ok && codec.Decode != nil {
+			err = codec.Decode(bytes.NewReader(b), into)
+		} else {
+			err = r.req.json().NewDecoder(bytes.NewReader(b)).Decode(into)
+		}
+	}
 	if err != nil {
 		r.req.err = handleResponseError(err, r.req, r)
 	}
-
-	r.Response.Body = ioutil.NopCloser(&buf)
 	return r
 }
 
+// GetJSONOptional decodes and stores the response body like GetJSON, but treats a
+// 204 or 205 status code or an empty body as "no value" and leaves into untouched
+// instead of failing
+func (r *Response) GetJSONOptional(into interface{}) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	if code := r.Response.StatusCode; code == http.StatusNoContent || code == http.StatusResetContent {
+		return r
+	}
+
+	b, err := r.readBody()
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+		return r
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return r
+	}
+	return r.GetJSON(into)
+}
+
 // Next allows a new request to be chained onto this request, assuming the first request
 // did not fail
 func (r *Response) Next() *Next {
-	return &Next{r.req.err}
+	if r.req.err != nil {
+		r.req.err = r.chainError()
+		return &Next{err: r.req.err}
+	}
+	steps := make([]Step, len(r.req.steps), len(r.req.steps)+1)
+	copy(steps, r.req.steps)
+	return &Next{steps: append(steps, r.step()), ctx: r.req.ctx}
 }
 
 // Done will return the first error that occured durring the request's life-cycle
 //
 // It is important to note that if any method errors, all subsequest methods will short
 // circut and not be execuited
+//
+// If the request was chained onto earlier requests the error is a *ChainError.
 func (r *Response) Done() error {
+	if r.req.err != nil && len(r.req.steps) > 0 {
+		r.req.err = r.chainError()
+	}
 	return r.req.err
 }
 
 // MarshalJSON implements `jsoniter.Marshaler` interface
 func (r *Request) MarshalJSON() ([]byte, error) {
-	return jsoniter.MarshalIndent(requestJSON{
+	return r.marshalRequest(false)
+}
+
+// marshalRequest encodes the request, hiding secrets if redact is set
+func (r *Request) marshalRequest(redact bool) ([]byte, error) {
+	value := requestJSON{
 		r.URL,
 		r.method,
-		string(r.data.Bytes()),
+		r.bodyString(),
 		r.headers,
-	}, "", "  ")
+		r.timingsJSON(),
+	}
+	if redact {
+		value.URL = redactURL(value.URL)
+		value.Data = redactString(value.Data)
+		value.Headers = redactHeaderMap(value.Headers)
+	}
+	return r.formatJSON(value)
 }
 
 // UnmarshalJSON implements `jsoniter.Unmarshaler` interface
@@ -183,7 +326,7 @@ func (r *Request) UnmarshalJSON(b []byte) error {
 
 	r.URL = temp.URL
 	r.method = temp.Method
-	r.data = bytes.NewBuffer([]byte(temp.Data))
+	r.Body(bytes.NewBufferString(temp.Data))
 	r.headers = temp.Headers
 
 	return nil
@@ -194,6 +337,7 @@ type requestJSON struct {
 	Method  string
 	Data    string
 	Headers map[string]string
+	Timings *timingsJSON `json:",omitempty"`
 }
 
 type responseJSON struct {
@@ -201,18 +345,39 @@ type responseJSON struct {
 	Header        http.Header
 	Body          string
 	ContentLength int64
+	Attempts      int `json:",omitempty"`
 }
 
 // MarshalJSON implements `jsoniter.Marshaler` interface
 func (r *Response) MarshalJSON() ([]byte, error) {
+	return r.marshalResponse(false)
+}
+
+// marshalResponse encodes the response, hiding secrets if redact is set
+func (r *Response) marshalResponse(redact bool) ([]byte, error) {
+	r.rewindBody()
 	defer r.Response.Body.Close()
 	body, _ := ioutil.ReadAll(r.Response.Body)
-	return jsoniter.MarshalIndent(responseJSON{
+	value := responseJSON{
 		r.Response.StatusCode,
-		r.Response.Header,
+		sanitizeHeader(r.Response.Header),
 		string(body),
 		r.Response.ContentLength,
-	}, "", "  ")
+		attemptsJSON(r.tries),
+	}
+	if redact {
+		value.Header = redactHeader(value.Header)
+		value.Body = redactString(value.Body)
+	}
+	return r.req.formatJSON(value)
+}
+
+// attemptsJSON only reports the number of attempts when the request was retried
+func attemptsJSON(tries int) int {
+	if tries > 1 {
+		return tries
+	}
+	return 0
 }
 
 // UnmarshalJSON implements `jsoniter.Unmarshaler` interface
@@ -222,11 +387,11 @@ func (r *Response) UnmarshalJSON(b []byte) error {
 }
 
 func (r *Request) format() string {
-	b, _ := jsoniter.MarshalIndent(r, "", "  ")
+	b, _ := r.marshalRequest(true)
 	return string(b)
 }
 
 func (r *Response) format() string {
-	b, _ := jsoniter.MarshalIndent(r, "", "  ")
+	b, _ := r.marshalResponse(true)
 	return string(b)
 }
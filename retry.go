@@ -0,0 +1,175 @@
+package quest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultMaxRetryAfter is the longest Retry-After waited for unless MaxRetryAfter
+// says otherwise
+const defaultMaxRetryAfter = time.Minute
+
+// retryStatusCodes are the status codes of transient failures retried by Retry
+var retryStatusCodes = map[int]bool{
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// idempotentMethods are safe to send twice
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// isIdempotent reports whether req can safely be sent again
+func isIdempotent(req *http.Request) bool {
+	if idempotentMethods[req.Method] {
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// isStaleConnError reports whether err is caused by the server closing a reused
+// connection (an idle timeout or an HTTP/2 GOAWAY) while the request was being sent
+func isStaleConnError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "server closed idle connection") ||
+		strings.Contains(msg, "GOAWAY") ||
+		strings.Contains(msg, "http2: client connection lost")
+}
+
+// rewind returns a copy of req with a fresh body so it can be sent again
+func rewind(req *http.Request) (*http.Request, bool) {
+	retry := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retry, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	retry.Body = body
+	return retry, true
+}
+
+// doRetryStale sends req and, if it failed because a pooled connection went away,
+// sends it once more on a fresh connection
+func doRetryStale(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err == nil || !isStaleConnError(err) || !isIdempotent(req) {
+		return resp, err
+	}
+	retry, ok := rewind(req)
+	if !ok {
+		return resp, err
+	}
+	client.CloseIdleConnections()
+	return client.Do(retry)
+}
+
+// doRetry sends req, retrying transient failures as configured by Retry. It
+// returns the number of attempts that were made.
+func (r *Request) doRetry(client *http.Client, req *http.Request) (*http.Response, int, error) {
+	attempt := 1
+	for {
+		resp, err := r.doSigned(client, req)
+		if attempt > r.retries || !r.shouldRetry(req.Context(), resp, err) {
+			if err != nil && attempt > 1 {
+				err = fmt.Errorf("after %d attempts: %w", attempt, err)
+			}
+			return resp, attempt, err
+		}
+		retry, rewound := rewind(req)
+		if !rewound {
+			return resp, attempt, err
+		}
+
+		delay, ok := r.retryAfter(resp)
+		maxDelay := r.maxRetryAfter
+		if maxDelay == 0 {
+			maxDelay = defaultMaxRetryAfter
+		}
+		if ok && maxDelay > 0 && delay > maxDelay {
+			return resp, attempt, err
+		}
+		if !ok {
+			backoff := r.backoff
+			if backoff == nil {
+				backoff = ExponentialBackoff{}
+			}
+			delay = backoff.Delay(attempt, r.random())
+		}
+		if err == nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), r.clock(), delay); err != nil {
+			return nil, attempt, fmt.Errorf("after %d attempts: %w", attempt, err)
+		}
+		req = retry
+		attempt++
+	}
+}
+
+// shouldRetry reports whether an attempt failed in a way that is worth retrying
+func (r *Request) shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err == nil {
+		if resp.StatusCode == http.StatusTooManyRequests {
+			// only retry when the server said when to
+			_, ok := r.retryAfter(resp)
+			return ok
+		}
+		return retryStatusCodes[resp.StatusCode]
+	}
+	if isPermanentError(err) {
+		return false
+	}
+	if kind := dnsErrorKind(err); kind != "" {
+		// a host that does not exist will not appear on the next attempt
+		return kind != dnsNotFound
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || isStaleConnError(err)
+}
+
+// isPermanentError reports whether err is a failure that sending the request again
+// cannot fix, like a rejected certificate or a redirect the client does not allow
+func isPermanentError(err error) bool {
+	if errors.Is(err, ErrHostNotAllowed) || errors.Is(err, ErrPlaintextNotAllowed) || errors.Is(err, errTooManyRedirects) {
+		return true
+	}
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalidCert x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	var recordHeader tls.RecordHeaderError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &invalidCert) ||
+		errors.As(err, &hostname) || errors.As(err, &recordHeader) ||
+		strings.Contains(err.Error(), "tls: ")
+}
@@ -0,0 +1,52 @@
+package quest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryAfter returns how long the server asked the client to wait with the
+// Retry-After header, given either in seconds or as an http date. ok is false if
+// the header is missing or invalid.
+func (r *Response) RetryAfter() (d time.Duration, ok bool) {
+	return r.req.retryAfter(r.Response)
+}
+
+// MaxRetryAfter stops Retry from waiting for a Retry-After longer than d; the
+// response is returned instead. The default is a minute and a negative d means no
+// limit.
+func (r *Request) MaxRetryAfter(d time.Duration) *Request {
+	r.maxRetryAfter = d
+	return r
+}
+
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if d := at.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// retryAfter returns the wait a retryable response asked for
+func (r *Request) retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	return parseRetryAfter(resp.Header.Get("Retry-After"), r.clock().Now())
+}
@@ -0,0 +1,58 @@
+package quest
+
+import (
+	"encoding/base64"
+	"net/http"
+)
+
+// scopedHeader is a client default header only sent to hosts matching pattern
+type scopedHeader struct {
+	pattern string
+	key     string
+	value   string
+}
+
+// ScopedHeader sets a header on every request from this client whose host matches
+// pattern. A pattern may start with "*." to match any subdomain, e.g.
+// "*.internal.example.com". Headers set on the request itself take precedence.
+//
+// Scoped headers are also removed when a redirect leaves the matching hosts.
+func (c *Client) ScopedHeader(pattern, key, value string) *Client {
+	c.scopedHeaders = append(c.scopedHeaders, scopedHeader{
+		pattern: pattern,
+		key:     http.CanonicalHeaderKey(key),
+		value:   value,
+	})
+	return c
+}
+
+// ScopedBasicAuth sets basic auth credentials on every request from this client
+// whose host matches pattern
+func (c *Client) ScopedBasicAuth(pattern, username, password string) *Client {
+	auth := username + ":" + password
+	return c.ScopedHeader(pattern, "Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
+}
+
+// ScopedBearer sets a bearer token on every request from this client whose host
+// matches pattern
+func (c *Client) ScopedBearer(pattern, token string) *Client {
+	return c.ScopedHeader(pattern, "Authorization", "Bearer "+token)
+}
+
+// applyScopedHeaders sets the scoped headers matching the request's host
+func (c *Client) applyScopedHeaders(req *http.Request) {
+	for _, h := range c.scopedHeaders {
+		if matchHost(h.pattern, req.URL.Hostname()) {
+			req.Header.Set(h.key, h.value)
+		}
+	}
+}
+
+// stripScopedHeaders removes scoped headers that do not match the request's host
+func (c *Client) stripScopedHeaders(req *http.Request) {
+	for _, h := range c.scopedHeaders {
+		if !matchHost(h.pattern, req.URL.Hostname()) && req.Header.Get(h.key) == h.value {
+			req.Header.Del(h.key)
+		}
+	}
+}
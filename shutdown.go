@@ -0,0 +1,115 @@
+package quest
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClientClosed is returned for requests sent through a Client after Close was
+// called
+var ErrClientClosed = errors.New("client is closed")
+
+// inFlight tracks the requests being sent by a client so Close can drain them
+type inFlight struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+	next   int
+	finish map[int]func()
+}
+
+// track registers a request that is about to be sent. The returned context is
+// canceled if the client is closed before the request finishes; finish must be
+// called once it has, e.g. when the response body is closed.
+func (f *inFlight) track(ctx context.Context) (context.Context, func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, nil, ErrClientClosed
+	}
+	if f.finish == nil {
+		f.finish = map[int]func(){}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	id := f.next
+	f.next++
+	f.wg.Add(1)
+	var once sync.Once
+	finish := func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.finish, id)
+			f.mu.Unlock()
+			cancel()
+			f.wg.Done()
+		})
+	}
+	f.finish[id] = finish
+	return ctx, finish, nil
+}
+
+// cancel cancels every request still in flight
+func (f *inFlight) cancel() {
+	f.mu.Lock()
+	finish := make([]func(), 0, len(f.finish))
+	for _, fn := range f.finish {
+		finish = append(finish, fn)
+	}
+	f.mu.Unlock()
+	for _, fn := range finish {
+		fn()
+	}
+}
+
+// Close stops the client from sending new requests (they fail with
+// ErrClientClosed), waits for the requests in flight and mirrored requests to
+// finish until ctx is done, cancels any that are left and closes idle
+// connections, including those of the transport copies made for its requests. It
+// returns ctx's error if requests had to be canceled.
+func (c *Client) Close(ctx context.Context) error {
+	tracked := []*inFlight{&c.inFlight}
+	if c.mirror != nil {
+		tracked = append(tracked, &c.mirror.requests)
+	}
+	for _, f := range tracked {
+		f.mu.Lock()
+		f.closed = true
+		f.mu.Unlock()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		for _, f := range tracked {
+			f.wg.Wait()
+		}
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		for _, f := range tracked {
+			f.cancel()
+		}
+		<-drained
+	}
+
+	c.derived.reset()
+	if c.transport != nil {
+		c.transport.CloseIdleConnections()
+	}
+	if t, ok := c.roundTripper.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+	return err
+}
+
+// inFlightCount returns the number of tracked requests
+func (c *Client) inFlightCount() int {
+	c.inFlight.mu.Lock()
+	defer c.inFlight.mu.Unlock()
+	return len(c.inFlight.finish)
+}
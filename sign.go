@@ -0,0 +1,142 @@
+package quest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Signer signs an outgoing request (e.g. adds an Authorization header) for the
+// given time. It is called again if the request has to be re-sent.
+type Signer func(req *http.Request, now time.Time) error
+
+// clockSkewCodes are the error codes upstreams use to reject a signed request whose
+// timestamp is too far from their own clock
+var clockSkewCodes = [][]byte{
+	[]byte("RequestTimeTooSkewed"),
+	[]byte("RequestExpired"),
+	[]byte("Signature expired"),
+	[]byte("clock skew"),
+}
+
+// Sign sets a signer that signs the request just before it is sent.
+//
+// If the upstream rejects the request because its timestamp is too far off (e.g.
+// AWS's RequestTimeTooSkewed) the offset to the upstream's clock is computed from
+// its Date header and the request is signed and sent once more with corrected time.
+func (r *Request) Sign(signer Signer) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.signer = signer
+	return r
+}
+
+// Sign sets a signer for every request from this client that does not have one.
+// Clock offsets learned from upstreams are remembered per host.
+func (c *Client) Sign(signer Signer) *Client {
+	c.signer = signer
+	return c
+}
+
+// clockSkew remembers the offset between our clock and each host's clock
+type clockSkew struct {
+	mu      sync.Mutex
+	offsets map[string]time.Duration
+}
+
+func (s *clockSkew) get(host string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offsets[host]
+}
+
+func (s *clockSkew) set(host string, offset time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.offsets == nil {
+		s.offsets = map[string]time.Duration{}
+	}
+	s.offsets[host] = offset
+}
+
+// skew returns where clock offsets for the request are remembered
+func (r *Request) skew() *clockSkew {
+	if r.client != nil {
+		return &r.client.skew
+	}
+	if r.localSkew == nil {
+		r.localSkew = &clockSkew{}
+	}
+	return r.localSkew
+}
+
+// getSigner returns the request's signer, falling back to the client's
+func (r *Request) getSigner() Signer {
+	if r.signer == nil && r.client != nil {
+		return r.client.signer
+	}
+	return r.signer
+}
+
+// doSigned signs and sends req, re-signing and sending it once more with corrected
+// time if the upstream rejected it for clock skew
+func (r *Request) doSigned(client *http.Client, req *http.Request) (*http.Response, error) {
+	signer := r.getSigner()
+	if signer == nil {
+		return doRetryStale(client, req)
+	}
+
+	host := req.URL.Host
+	skew := r.skew()
+	if err := signer(req, r.clock().Now().Add(skew.get(host))); err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	resp, err := doRetryStale(client, req)
+	if err != nil || !isClockSkewResponse(resp) {
+		return resp, err
+	}
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return resp, nil
+	}
+	retry, ok := rewind(req)
+	if !ok {
+		return resp, nil
+	}
+	skew.set(host, serverTime.Sub(r.clock().Now()))
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if err := signer(retry, r.clock().Now().Add(skew.get(host))); err != nil {
+		closeBody(retry)
+		return nil, err
+	}
+	return doRetryStale(client, retry)
+}
+
+// isClockSkewResponse reports whether resp rejects the request for clock skew. The
+// start of the body is inspected and put back so it can still be read.
+func isClockSkewResponse(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+	default:
+		return false
+	}
+	head, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	for _, code := range clockSkewCodes {
+		if bytes.Contains(head, code) {
+			return true
+		}
+	}
+	return false
+}
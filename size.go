@@ -0,0 +1,102 @@
+package quest
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// countingReader counts the bytes read through it and calls done once, when the
+// reader is exhausted or closed
+type countingReader struct {
+	io.ReadCloser
+	n    *int64
+	once sync.Once
+	done func()
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	if err == io.EOF {
+		c.finish()
+	}
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	err := c.ReadCloser.Close()
+	c.finish()
+	return err
+}
+
+func (c *countingReader) finish() {
+	if c.done != nil {
+		c.once.Do(c.done)
+	}
+}
+
+// countRequestBody counts the bytes of req's body that are sent, including any
+// re-sends of it (e.g. on redirects or retries)
+func countRequestBody(req *http.Request, n *int64) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	req.Body = &countingReader{ReadCloser: req.Body, n: n}
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return &countingReader{ReadCloser: body, n: n}, nil
+		}
+	}
+}
+
+// BytesWritten returns the number of request body bytes that were sent
+func (r *Response) BytesWritten() int64 {
+	if r.written == nil {
+		return 0
+	}
+	return atomic.LoadInt64(r.written)
+}
+
+// BytesRead returns the number of response body bytes that have been read so far
+func (r *Response) BytesRead() int64 {
+	if r.read == nil {
+		return 0
+	}
+	return atomic.LoadInt64(r.read)
+}
+
+// countResponseBody counts the bytes read from the response body and reports the
+// request and response sizes to the metrics hooks once the body is done
+func (r *Response) countResponseBody() {
+	r.read = new(int64)
+	if r.Response == nil || r.Response.Body == nil {
+		return
+	}
+	r.Response.Body = &countingReader{
+		ReadCloser: r.Response.Body,
+		n:          r.read,
+		done:       r.bodyDone,
+	}
+}
+
+func (r *Response) bodyDone() {
+	if r.req.timings != nil {
+		r.req.timings.finish()
+	}
+	r.reportSizes()
+}
+
+func (r *Response) reportSizes() {
+	labels := map[string]string{"method": r.req.method, "host": r.req.URL.Host, "status_class": statusClass(r.Response, nil)}
+	if name := r.req.operationName(); name != "" {
+		labels["operation"] = name
+	}
+	r.req.emit(Metric{Name: MetricRequestBytes, Value: float64(r.BytesWritten()), Labels: labels})
+	r.req.emit(Metric{Name: MetricResponseBytes, Value: float64(r.BytesRead()), Labels: labels})
+}
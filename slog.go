@@ -0,0 +1,121 @@
+//go:build go1.21
+
+package quest
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// LogLevels are the levels requests are logged at by a logger set with WithLogger
+type LogLevels struct {
+	// Start is the level of the message logged before a request is sent
+	Start slog.Level
+	// Success, ClientError and ServerError are the levels of the message logged
+	// when a 1xx-3xx, 4xx or 5xx response is received
+	Success     slog.Level
+	ClientError slog.Level
+	ServerError slog.Level
+	// Error is the level of the message logged when no response was received
+	Error slog.Level
+}
+
+// DefaultLogLevels are the levels used unless WithLogLevels is called
+var DefaultLogLevels = LogLevels{
+	Start:       slog.LevelDebug,
+	Success:     slog.LevelInfo,
+	ClientError: slog.LevelWarn,
+	ServerError: slog.LevelError,
+	Error:       slog.LevelError,
+}
+
+// SetDefaultLogger sets the logger for requests that have no logger of their own
+// or from their client. Passing nil disables logging, which is the default.
+func SetDefaultLogger(logger *slog.Logger, levels LogLevels) {
+	defaultLogger.Lock()
+	defer defaultLogger.Unlock()
+	if logger == nil {
+		defaultLogger.logger = nil
+		return
+	}
+	defaultLogger.logger = &slogLogger{logger, levels}
+}
+
+// WithLogger logs the start and end of the request to logger, with its method,
+// URL, status, duration and error
+func (r *Request) WithLogger(logger *slog.Logger) *Request {
+	r.log = &slogLogger{logger, r.logLevels()}
+	return r
+}
+
+// WithLogLevels sets the levels the request is logged at
+func (r *Request) WithLogLevels(levels LogLevels) *Request {
+	logger := slog.Default()
+	if l, ok := r.logger().(*slogLogger); ok {
+		logger = l.logger
+	}
+	r.log = &slogLogger{logger, levels}
+	return r
+}
+
+// WithLogger logs the start and end of every request from this client to logger
+func (c *Client) WithLogger(logger *slog.Logger, levels LogLevels) *Client {
+	c.log = &slogLogger{logger, levels}
+	return c
+}
+
+func (r *Request) logLevels() LogLevels {
+	if l, ok := r.logger().(*slogLogger); ok {
+		return l.levels
+	}
+	return DefaultLogLevels
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+	levels LogLevels
+}
+
+func (l *slogLogger) start(r *Request) {
+	l.logger.LogAttrs(r.logContext(), l.levels.Start, "quest: sending request", r.logAttrs()...)
+}
+
+func (l *slogLogger) finish(r *Request, resp *Response, err error, d time.Duration) {
+	attrs := append(r.logAttrs(), slog.Duration("duration", d))
+	level := l.levels.Success
+	switch {
+	case err != nil:
+		level = l.levels.Error
+		attrs = append(attrs, slog.String("error", err.Error()))
+	case resp.StatusCode >= 500:
+		level = l.levels.ServerError
+	case resp.StatusCode >= 400:
+		level = l.levels.ClientError
+	}
+	if resp != nil && resp.Response != nil && resp.StatusCode != 0 {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	if resp != nil && resp.tries > 1 {
+		attrs = append(attrs, slog.Int("attempts", resp.tries))
+	}
+	l.logger.LogAttrs(r.logContext(), level, "quest: request finished", attrs...)
+}
+
+func (r *Request) logAttrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("method", r.method),
+		slog.String("url", redactURL(r.URL).String()),
+	}
+	if name := r.operationName(); name != "" {
+		attrs = append(attrs, slog.String("operation", name))
+	}
+	return attrs
+}
+
+func (r *Request) logContext() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
@@ -0,0 +1,42 @@
+//go:build go1.21
+
+package quest
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithLogger(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	Get(ts.URL + "/users").WithLogger(logger).Send()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %q", out.String())
+	}
+	if !strings.Contains(lines[0], "level=DEBUG") || !strings.Contains(lines[0], "method=GET") {
+		t.Errorf("Unexpected start line %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "level=WARN") || !strings.Contains(lines[1], "status=404") || !strings.Contains(lines[1], "url="+ts.URL+"/users") {
+		t.Errorf("Unexpected finish line %q", lines[1])
+	}
+
+	out.Reset()
+	levels := DefaultLogLevels
+	levels.ClientError = slog.LevelInfo
+	Get(ts.URL).WithLogger(logger).WithLogLevels(levels).Send()
+	if !strings.Contains(out.String(), "level=INFO") {
+		t.Errorf("Expected custom level, got %q", out.String())
+	}
+}
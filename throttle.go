@@ -0,0 +1,109 @@
+package quest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ThrottleSettings configures Client.AdaptiveThrottle
+type ThrottleSettings struct {
+	// MaxRate is the request rate (per second) a host is allowed once it has fully
+	// recovered. Requests to a host are not throttled while it is at MaxRate.
+	MaxRate float64
+	// MinRate is the lowest rate a host is throttled down to. Defaults to 1.
+	MinRate float64
+	// Increase is added to a host's rate after every successful response.
+	// Defaults to a tenth of MaxRate.
+	Increase float64
+	// Decrease multiplies a host's rate after every 429 or 503 response.
+	// Defaults to 0.5.
+	Decrease float64
+}
+
+// AdaptiveThrottle makes the client slow down requests to a host after it responds
+// with 429 (Too Many Requests) or 503 (Service Unavailable) and speed back up
+// gradually as requests succeed (additive increase, multiplicative decrease)
+func (c *Client) AdaptiveThrottle(settings ThrottleSettings) *Client {
+	if settings.MinRate <= 0 {
+		settings.MinRate = 1
+	}
+	if settings.Increase <= 0 {
+		settings.Increase = settings.MaxRate / 10
+	}
+	if settings.Decrease <= 0 || settings.Decrease >= 1 {
+		settings.Decrease = 0.5
+	}
+	c.throttle = &throttle{
+		settings: settings,
+		hosts:    map[string]*hostThrottle{},
+		report:   c.reportThrottle,
+	}
+	return c
+}
+
+func (c *Client) reportThrottle(host string, rate float64) {
+	c.emit(Metric{Name: MetricThrottleRate, Value: rate, Labels: map[string]string{"host": host}})
+}
+
+// throttle paces requests to each host according to its current rate
+type throttle struct {
+	settings ThrottleSettings
+	mu       sync.Mutex
+	hosts    map[string]*hostThrottle
+	report   func(host string, rate float64)
+}
+
+type hostThrottle struct {
+	rate float64
+	next time.Time
+}
+
+// wait blocks until the next request to host may be sent or the context is done
+func (t *throttle) wait(ctx context.Context, clock Clock, host string) error {
+	t.mu.Lock()
+	h, ok := t.hosts[host]
+	if !ok || h.rate >= t.settings.MaxRate {
+		t.mu.Unlock()
+		return nil
+	}
+	now := clock.Now()
+	at := h.next
+	if at.Before(now) {
+		at = now
+	}
+	h.next = at.Add(time.Duration(float64(time.Second) / h.rate))
+	t.mu.Unlock()
+
+	return sleep(ctx, clock, at.Sub(now))
+}
+
+// observe adjusts host's rate after a response with the given status code
+func (t *throttle) observe(host string, code int) {
+	t.mu.Lock()
+	h, ok := t.hosts[host]
+	if !ok {
+		h = &hostThrottle{rate: t.settings.MaxRate}
+		t.hosts[host] = h
+	}
+	before := h.rate
+	switch {
+	case code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable:
+		h.rate *= t.settings.Decrease
+		if h.rate < t.settings.MinRate {
+			h.rate = t.settings.MinRate
+		}
+	case code < 500:
+		h.rate += t.settings.Increase
+		if h.rate > t.settings.MaxRate {
+			h.rate = t.settings.MaxRate
+		}
+	}
+	rate := h.rate
+	t.mu.Unlock()
+
+	if rate != before && t.report != nil {
+		t.report(host, rate)
+	}
+}
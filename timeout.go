@@ -0,0 +1,98 @@
+package quest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Phases a request can be in when it times out, next to the ones that can be given
+// their own timeout
+const (
+	PhaseWriteRequest = "write request"
+	PhaseResponseBody = "response body"
+)
+
+// phaseActivities describe what a request was doing in each phase
+var phaseActivities = map[string]string{
+	PhaseDial:           "dialing",
+	PhaseDNS:            "resolving the host",
+	PhaseConnect:        "connecting",
+	PhaseTLS:            "performing the tls handshake",
+	PhaseWriteRequest:   "writing the request",
+	PhaseResponseHeader: "waiting for the response headers",
+	PhaseResponseBody:   "reading the response body",
+}
+
+// TimeoutError is returned when a request times out, e.g. because its context's
+// deadline passed or its Timeout expired. Phase is the phase that was in progress,
+// so slow upstreams (PhaseResponseHeader) can be told apart from network issues
+// (PhaseDial, PhaseConnect, PhaseTLS).
+type TimeoutError struct {
+	Phase string
+	err   error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%v while %s", e.err, phaseActivities[e.Phase])
+}
+
+// Unwrap returns the underlying timeout, e.g. context.DeadlineExceeded or a
+// *PhaseTimeoutError
+func (e *TimeoutError) Unwrap() error {
+	return e.err
+}
+
+// Timeout reports true so the error behaves like other network timeouts
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// isTimeout reports whether err is caused by a deadline or timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// attributeTimeout wraps err in a *TimeoutError for phase if it is a timeout that
+// does not already say which phase it happened in
+func attributeTimeout(err error, phase string) error {
+	if err == nil || phaseActivities[phase] == "" || !isTimeout(err) {
+		return err
+	}
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return err
+	}
+	var phaseErr *PhaseTimeoutError
+	if errors.As(err, &phaseErr) && phaseErr.Phase != PhaseRequest {
+		return err
+	}
+	return &TimeoutError{Phase: phase, err: err}
+}
+
+// timeoutBody attributes timeouts while reading a response body to
+// PhaseResponseBody
+type timeoutBody struct {
+	io.ReadCloser
+	timer *phaseTimer
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		if b.timer != nil {
+			// the request timeout cancels the context, which shows up as a
+			// cancellation rather than a timeout
+			if expired := b.timer.expiredError(); expired != nil {
+				err = expired
+			}
+		}
+		err = attributeTimeout(err, PhaseResponseBody)
+	}
+	return n, err
+}
@@ -0,0 +1,164 @@
+package quest
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings is a breakdown of how long the phases of a request took. When the
+// request was retried the timings are of the last attempt. Phases that did not
+// happen, e.g. DNS and Connect on a reused connection, are zero.
+type Timings struct {
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// TTFB is the time from getting a connection to the first response byte
+	TTFB time.Duration
+	// Total is the time from sending the request until the response body was read
+	// or closed, or until the response headers arrived if the body was not read yet
+	Total time.Duration
+	// Reused reports whether the connection was reused from the pool
+	Reused bool
+}
+
+// Timings returns the timing breakdown of the request
+func (r *Response) Timings() Timings {
+	if r.req.timings == nil {
+		return Timings{}
+	}
+	return r.req.timings.get()
+}
+
+// timingTrace records Timings through httptrace
+type timingTrace struct {
+	mu      sync.Mutex
+	timings Timings
+	start   time.Time
+	getConn time.Time
+	dns     time.Time
+	connect time.Time
+	tls     time.Time
+	phase   string
+}
+
+// attach records the timings of req from now on
+func (t *timingTrace) attach(req *http.Request) *http.Request {
+	t.start = time.Now()
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			t.getConn = time.Now()
+			t.timings = Timings{}
+			t.phase = PhaseDial
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.timings.Reused = info.Reused
+			t.phase = PhaseWriteRequest
+			t.mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mark(&t.dns)
+			t.setPhase(PhaseDNS)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.since(&t.timings.DNS, t.dns)
+			t.setPhase(PhaseDial)
+		},
+		ConnectStart: func(network, addr string) {
+			t.mark(&t.connect)
+			t.setPhase(PhaseConnect)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				t.since(&t.timings.Connect, t.connect)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mark(&t.tls)
+			t.setPhase(PhaseTLS)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.since(&t.timings.TLSHandshake, t.tls)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { t.setPhase(PhaseResponseHeader) },
+		GotFirstResponseByte: func() {
+			t.since(&t.timings.TTFB, t.getConn)
+			t.finish()
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+func (t *timingTrace) mark(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *timingTrace) since(d *time.Duration, start time.Time) {
+	t.mu.Lock()
+	*d = time.Since(start)
+	t.mu.Unlock()
+}
+
+func (t *timingTrace) setPhase(phase string) {
+	t.mu.Lock()
+	t.phase = phase
+	t.mu.Unlock()
+}
+
+// currentPhase returns the phase the request is in
+func (t *timingTrace) currentPhase() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.phase
+}
+
+// finish sets the total time to now
+func (t *timingTrace) finish() {
+	t.mu.Lock()
+	t.timings.Total = time.Since(t.start)
+	t.mu.Unlock()
+}
+
+func (t *timingTrace) get() Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timings
+}
+
+// timingsJSON is how timings are shown in errors and debug output
+type timingsJSON struct {
+	DNS          string `json:",omitempty"`
+	Connect      string `json:",omitempty"`
+	TLSHandshake string `json:",omitempty"`
+	TTFB         string `json:",omitempty"`
+	Total        string `json:",omitempty"`
+	Reused       bool   `json:",omitempty"`
+}
+
+func (r *Request) timingsJSON() *timingsJSON {
+	if r.timings == nil {
+		return nil
+	}
+	t := r.timings.get()
+	format := func(d time.Duration) string {
+		if d <= 0 {
+			return ""
+		}
+		return d.String()
+	}
+	return &timingsJSON{
+		DNS:          format(t.DNS),
+		Connect:      format(t.Connect),
+		TLSHandshake: format(t.TLSHandshake),
+		TTFB:         format(t.TTFB),
+		Total:        format(t.Total),
+		Reused:       t.Reused,
+	}
+}
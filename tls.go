@@ -0,0 +1,69 @@
+package quest
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrPlaintextNotAllowed is returned for http:// requests when TLS is required
+var ErrPlaintextNotAllowed = errors.New("plaintext http is not allowed")
+
+// tlsPolicy decides what happens to requests for http:// urls
+type tlsPolicy int
+
+const (
+	tlsDefault tlsPolicy = iota
+	tlsAllowPlaintext
+	tlsRequire
+	tlsUpgrade
+)
+
+// RequireTLS makes requests from this client for http:// urls fail, including
+// redirects to them
+func (c *Client) RequireTLS() *Client {
+	c.tls = tlsRequire
+	return c
+}
+
+// UpgradeToTLS makes requests from this client for http:// urls use https instead
+func (c *Client) UpgradeToTLS() *Client {
+	c.tls = tlsUpgrade
+	return c
+}
+
+// RequireTLS makes the request fail if its url is http://
+func (r *Request) RequireTLS() *Request {
+	r.tls = tlsRequire
+	return r
+}
+
+// AllowPlaintext allows the request to use an http:// url even when its client
+// requires TLS
+func (r *Request) AllowPlaintext() *Request {
+	r.tls = tlsAllowPlaintext
+	return r
+}
+
+// tlsPolicy returns the request's policy, falling back to the client's
+func (r *Request) tlsPolicy() tlsPolicy {
+	if r.tls == tlsDefault && r.client != nil {
+		return r.client.tls
+	}
+	return r.tls
+}
+
+// checkTLS fails, or upgrades u to https, if u is plaintext and TLS is required
+func (r *Request) checkTLS(u *url.URL) error {
+	if !strings.EqualFold(u.Scheme, "http") {
+		return nil
+	}
+	switch r.tlsPolicy() {
+	case tlsRequire:
+		return fmt.Errorf("%w: %q", ErrPlaintextNotAllowed, u.String())
+	case tlsUpgrade:
+		u.Scheme = "https"
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package quest
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucketStore holds the state of the client's token buckets. The default
+// store keeps it in memory so every process limits on its own; an implementation
+// backed by e.g. Redis lets a fleet of processes share one quota.
+type TokenBucketStore interface {
+	// Take takes a token from the bucket named key, which is refilled at rate
+	// tokens per second up to burst tokens. It returns zero when a token was taken,
+	// or how long to wait before trying again. Implementations must take tokens
+	// atomically, e.g. with a Lua script in Redis.
+	Take(ctx context.Context, key string, rate float64, burst int, now time.Time) (time.Duration, error)
+}
+
+// RateLimit limits the requests sent to each host to perSecond requests per second,
+// allowing bursts of up to burst requests. Requests over the limit wait for a
+// token.
+func (c *Client) RateLimit(perSecond float64, burst int) *Client {
+	if c.tokens == nil {
+		c.tokens = &tokenBuckets{store: NewMemoryTokenStore()}
+	}
+	c.tokens.rate, c.tokens.burst = perSecond, burst
+	return c
+}
+
+// RateLimitStore sets the store the client's RateLimit tokens are kept in. prefix
+// is prepended to the host to form the bucket's key, so clients for different
+// quotas can share a store.
+func (c *Client) RateLimitStore(store TokenBucketStore, prefix string) *Client {
+	if c.tokens == nil {
+		c.tokens = &tokenBuckets{}
+	}
+	c.tokens.store, c.tokens.prefix = store, prefix
+	return c
+}
+
+// tokenBuckets is the client's RateLimit configuration
+type tokenBuckets struct {
+	store  TokenBucketStore
+	prefix string
+	rate   float64
+	burst  int
+}
+
+// wait blocks until a token for host is taken or the context is done
+func (b *tokenBuckets) wait(ctx context.Context, clock Clock, host string) error {
+	if b.rate <= 0 || b.store == nil {
+		return nil
+	}
+	for {
+		d, err := b.store.Take(ctx, b.prefix+host, b.rate, b.burst, clock.Now())
+		if err != nil || d <= 0 {
+			return err
+		}
+		if err := sleep(ctx, clock, d); err != nil {
+			return err
+		}
+	}
+}
+
+// MemoryTokenStore is a TokenBucketStore that keeps its buckets in memory
+type MemoryTokenStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewMemoryTokenStore creates an empty MemoryTokenStore
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{buckets: map[string]*tokenBucket{}}
+}
+
+// Take implements TokenBucketStore
+func (s *MemoryTokenStore) Take(ctx context.Context, key string, rate float64, burst int, now time.Time) (time.Duration, error) {
+	if burst < 1 {
+		burst = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed.Seconds()*rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, nil
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second)), nil
+}
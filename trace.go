@@ -0,0 +1,57 @@
+package quest
+
+import (
+	"fmt"
+	"reflect"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// traceIDs returns the trace and span ID of the request's span, or of the span in
+// its context when the request failed before its own span was started. Both are
+// empty when tracing is not enabled.
+func (r *Request) traceIDs() (traceID, spanID string) {
+	ctx := r.span
+	if ctx == nil && r.ctx != nil {
+		if span := opentracing.SpanFromContext(r.ctx); span != nil {
+			ctx = span.Context()
+		}
+	}
+	if ctx == nil {
+		return "", ""
+	}
+	return spanContextID(ctx, "TraceID"), spanContextID(ctx, "SpanID")
+}
+
+// spanContextID reads an ID from a span context. OpenTracing does not define how
+// tracers expose their IDs, but the common ones use either a method (Jaeger,
+// OpenTelemetry bridge) or a field (mocktracer, Zipkin) with the given name.
+func spanContextID(ctx opentracing.SpanContext, name string) string {
+	v := reflect.ValueOf(ctx)
+	if m := v.MethodByName(name); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+		return idString(m.Call(nil)[0])
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	if f := v.FieldByName(name); f.IsValid() && f.CanInterface() {
+		return idString(f)
+	}
+	return ""
+}
+
+func idString(v reflect.Value) string {
+	if v.IsZero() {
+		return ""
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
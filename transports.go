@@ -0,0 +1,93 @@
+package quest
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+)
+
+// maxDerivedTransports is how many copies a derivedTransports keeps. When it is
+// full the least recently used copy is closed and forgotten.
+const maxDerivedTransports = 16
+
+// derivedTransports holds copies of base transports with request options (like
+// LocalAddr) applied, so requests with the same options share connections. A
+// Client owns the copies made for its requests and closes them when its
+// configuration changes or it is closed. Requests without a Client share
+// defaultTransports.
+type derivedTransports struct {
+	mu         sync.Mutex
+	transports map[derivedKey]*list.Element
+	recent     list.List
+}
+
+type derivedKey struct {
+	base           *http.Transport
+	localAddr      string
+	maxHeaderBytes int64
+	noKeepAlive    bool
+}
+
+type derivedTransport struct {
+	key       derivedKey
+	transport *http.Transport
+}
+
+// defaultTransports holds the copies made for requests without a Client
+var defaultTransports derivedTransports
+
+// get returns the copy for key, creating it with build on first use
+func (d *derivedTransports) get(key derivedKey, build func() *http.Transport) *http.Transport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.transports[key]; ok {
+		d.recent.MoveToFront(e)
+		return e.Value.(*derivedTransport).transport
+	}
+	if d.transports == nil {
+		d.transports = map[derivedKey]*list.Element{}
+	}
+	if d.recent.Len() >= maxDerivedTransports {
+		oldest := d.recent.Remove(d.recent.Back()).(*derivedTransport)
+		delete(d.transports, oldest.key)
+		oldest.transport.CloseIdleConnections()
+	}
+	t := build()
+	d.transports[key] = d.recent.PushFront(&derivedTransport{key, t})
+	return t
+}
+
+// reset closes the idle connections of every copy and forgets them, so the next
+// request copies its base transport again with the current configuration
+func (d *derivedTransports) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for e := d.recent.Front(); e != nil; e = e.Next() {
+		e.Value.(*derivedTransport).transport.CloseIdleConnections()
+	}
+	d.transports = nil
+	d.recent.Init()
+}
+
+// cloneTransport copies base, or http.DefaultTransport when base is nil
+func cloneTransport(base *http.Transport) *http.Transport {
+	if base == nil {
+		return http.DefaultTransport.(*http.Transport).Clone()
+	}
+	return base.Clone()
+}
+
+// derivedTransports returns where copies of the request's transport are kept
+func (r *Request) derivedTransports() *derivedTransports {
+	if r.client != nil {
+		return &r.client.derived
+	}
+	return &defaultTransports
+}
+
+// configureTransport returns the client's transport so an option can change it.
+// Copies made from the old configuration are discarded.
+func (c *Client) configureTransport() *http.Transport {
+	c.derived.reset()
+	return c.httpTransport()
+}
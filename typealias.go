@@ -0,0 +1,43 @@
+package quest
+
+import "sync"
+
+// typeAliases maps short names to MIME types for ExpectType
+var typeAliases = struct {
+	sync.RWMutex
+	types map[string]string
+}{
+	types: map[string]string{
+		"html":            "text/html",
+		"json":            "application/json",
+		"jsonapi":         "application/vnd.api+json",
+		"msgpack":         "application/msgpack",
+		"protobuf-stream": "application/x-protobuf-stream",
+		"xml":             "application/xml",
+		"yaml":            "application/yaml",
+		"text":            "text/plain",
+		"urlencoded":      "application/x-www-form-urlencoded",
+		"form":            "application/x-www-form-urlencoded",
+		"form-data":       "application/x-www-form-urlencoded",
+	},
+}
+
+// RegisterTypeAlias registers a short name for a MIME type so it can be used with
+// ExpectType, e.g. RegisterTypeAlias("orders", "application/vnd.acme.orders+json").
+// Registering an existing alias replaces it.
+func RegisterTypeAlias(alias, mimeType string) {
+	typeAliases.Lock()
+	typeAliases.types[alias] = mimeType
+	typeAliases.Unlock()
+}
+
+// lookupTypeAlias returns the MIME type for alias, or alias itself if it is not
+// registered
+func lookupTypeAlias(alias string) string {
+	typeAliases.RLock()
+	defer typeAliases.RUnlock()
+	if mimeType, ok := typeAliases.types[alias]; ok {
+		return mimeType
+	}
+	return alias
+}
@@ -0,0 +1,96 @@
+package quest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// fallback is the method a request is sent again with when the server answers one
+// of statusCodes
+type fallback struct {
+	method      string
+	statusCodes []int
+}
+
+// Upsert creates a new http "PUT" request for path (uri) with value as its JSON
+// body, which is sent again as a "POST" if the server answers 404 or 405. This is
+// the common REST idiom for "replace, or create if it does not exist". Use
+// Fallback to change the method or status codes.
+func Upsert(path string, value interface{}) *Request {
+	return New(http.MethodPut, path).JSONBody(value).
+		Fallback(http.MethodPost, http.StatusNotFound, http.StatusMethodNotAllowed)
+}
+
+// Upsert creates a new upsert request (see Upsert) for path (uri) on this client
+func (c *Client) Upsert(path string, value interface{}) *Request {
+	return c.New(http.MethodPut, path).JSONBody(value).
+		Fallback(http.MethodPost, http.StatusNotFound, http.StatusMethodNotAllowed)
+}
+
+// Fallback sends the request again with method if the server answers one of
+// statusCodes, e.g. a "POST" that falls back to "PUT" on 409 Conflict. The body and
+// headers are sent again as they are, except that a fallback to a method that is
+// not idempotent gets its own Idempotency-Key: one derived from the request's key
+// if it has one, so retrying the whole call reuses it, or a random one otherwise.
+func (r *Request) Fallback(method string, statusCodes ...int) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.fallback = &fallback{method, statusCodes}
+	return r
+}
+
+// sendFallback sends the request with its fallback method if resp calls for it
+func (r *Request) sendFallback(resp *Response) *Response {
+	if r.err != nil || !r.fallback.matches(resp.StatusCode) {
+		return resp
+	}
+	io.Copy(ioutil.Discard, resp.Response.Body)
+	resp.Response.Body.Close()
+
+	retry := r.clone()
+	retry.method = r.fallback.method
+	retry.fallback = nil
+	if !idempotentMethods[retry.method] {
+		key := fallbackIdempotencyKey(r.headers, retry.method)
+		for name := range retry.headers {
+			if isIdempotencyKey(name) {
+				delete(retry.headers, name)
+			}
+		}
+		retry.headers["Idempotency-Key"] = key
+	}
+	return retry.Send()
+}
+
+func (f *fallback) matches(statusCode int) bool {
+	for _, code := range f.statusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackIdempotencyKey returns the Idempotency-Key for a fallback to method.
+// Servers reject a key that is reused for a different request, so the fallback
+// cannot share the key of the original request.
+func fallbackIdempotencyKey(headers map[string]string, method string) string {
+	for name, key := range headers {
+		if isIdempotencyKey(name) && key != "" {
+			return key + "-" + strings.ToLower(method)
+		}
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isIdempotencyKey(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	return name == "Idempotency-Key" || name == "X-Idempotency-Key"
+}
@@ -0,0 +1,69 @@
+package quest
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// ErrURLTooLong is returned for requests whose url is longer than MaxURLLength
+var ErrURLTooLong = errors.New("url is too long")
+
+// URLValidator checks the url of a request before it is sent. template is the path
+// the request was created with, before Param and QueryParam were applied (e.g.
+// "/users/:id").
+type URLValidator func(u *url.URL, template string) error
+
+// MaxURLLength fails the request before it is sent if its url, including the query
+// string, is longer than n bytes. Many proxies reject long urls with an opaque 414
+// or cut them off. A value of zero (the default) means no limit.
+func (r *Request) MaxURLLength(n int) *Request {
+	r.maxURLLength = n
+	return r
+}
+
+// ValidateURL adds a check that the request's url must pass before it is sent, e.g.
+// to enforce that path templates carry no query string. The request fails with the
+// error the validator returns.
+func (r *Request) ValidateURL(validator URLValidator) *Request {
+	r.urlValidators = append(r.urlValidators, validator)
+	return r
+}
+
+// MaxURLLength sets MaxURLLength for every request from this client
+func (c *Client) MaxURLLength(n int) *Client {
+	c.maxURLLength = n
+	return c
+}
+
+// ValidateURL adds a url check for every request from this client. It runs before
+// the request's own validators.
+func (c *Client) ValidateURL(validator URLValidator) *Client {
+	c.urlValidators = append(c.urlValidators, validator)
+	return c
+}
+
+// checkURL fails if the request's url is too long or rejected by a validator
+func (r *Request) checkURL() error {
+	max := r.maxURLLength
+	var validators []URLValidator
+	if r.client != nil {
+		if max <= 0 {
+			max = r.client.maxURLLength
+		}
+		validators = append(validators, r.client.urlValidators...)
+	}
+	validators = append(validators, r.urlValidators...)
+
+	if max > 0 {
+		if n := len(r.URL.String()); n > max {
+			return fmt.Errorf("%w: %d bytes, the limit is %d", ErrURLTooLong, n, max)
+		}
+	}
+	for _, validator := range validators {
+		if err := validator(r.URL, r.rawPath); err != nil {
+			return fmt.Errorf("invalid url: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package quest
+
+import "net/http"
+
+// hopHeaders only apply to a single connection and are never copied by
+// WriteResponse
+var hopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// WriteResponse replies to w with the response: it copies the status code and the
+// headers in headerAllowlist (DefaultProxyHeaders if nil), then streams the body
+// without buffering it, flushing as Proxy does. Hop-by-hop headers like Connection
+// are never copied. This makes quest a building block for API gateway style
+// handlers:
+//
+//	quest.Get(upstream).WithContext(r.Context()).Send().WriteResponse(w, []string{"Content-Type", "Etag"})
+//
+// The body is consumed and cannot be read again.
+func (r *Response) WriteResponse(w http.ResponseWriter, headerAllowlist []string) *Response {
+	if headerAllowlist == nil {
+		headerAllowlist = DefaultProxyHeaders
+	}
+	headers := make([]string, 0, len(headerAllowlist))
+	for _, key := range headerAllowlist {
+		if !hopHeaders[http.CanonicalHeaderKey(key)] {
+			headers = append(headers, key)
+		}
+	}
+	return r.proxyStream(r.req.Context(), w, -1, headers)
+}
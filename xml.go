@@ -0,0 +1,40 @@
+package quest
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// XMLBody encodes value with the codec registered for application/xml (encoding/xml
+// by default) and sets it as the body of the request
+func (r *Request) XMLBody(value interface{}) *Request {
+	return r.BodyAs("application/xml", value)
+}
+
+// GetXML decodes the response body into into with the codec registered for
+// application/xml, regardless of the Content-Type the server returned
+func (r *Response) GetXML(into interface{}) *Response {
+	return r.decodeAs("application/xml", into)
+}
+
+// decodeAs decodes the response body into into with the codec registered for
+// mediaType
+func (r *Response) decodeAs(mediaType string, into interface{}) *Response {
+	if r.req.err != nil {
+		return r
+	}
+	codec, ok := lookupCodec(mediaType)
+	if !ok || codec.Decode == nil {
+		r.req.err = handleResponseError(fmt.Errorf("no decoder registered for %q", mediaType), r.req, r)
+		return r
+	}
+
+	b, err := r.readBody()
+	if err == nil {
+		err = codec.Decode(bytes.NewReader(b), into)
+	}
+	if err != nil {
+		r.req.err = handleResponseError(err, r.req, r)
+	}
+	return r
+}
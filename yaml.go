@@ -0,0 +1,17 @@
+package quest
+
+// YAMLBody encodes value with the codec registered for application/yaml and sets it
+// as the body of the request. Importing the questyaml package registers a YAML
+// codec:
+//
+//	import _ "github.com/nicksrandall/quest/questyaml"
+func (r *Request) YAMLBody(value interface{}) *Request {
+	return r.BodyAs("application/yaml", value)
+}
+
+// GetYAML decodes the response body into into with the codec registered for
+// application/yaml (see YAMLBody), regardless of the Content-Type the server
+// returned
+func (r *Response) GetYAML(into interface{}) *Response {
+	return r.decodeAs("application/yaml", into)
+}